@@ -0,0 +1,41 @@
+package mapsmith
+
+// DecodeRecord describes one value written during a decode. Field is the Go
+// name of the struct field written to and SourceKey the dotted path of the
+// source entry; for entries stored in a catch-all, Field names the catch-all
+// map. RawValue is the source value as given and SetValue the value actually
+// stored after coercion.
+type DecodeRecord struct {
+	Field     string
+	SourceKey string
+	RawValue  interface{}
+	SetValue  interface{}
+}
+
+// FromMapWithAudit decodes m into dest and returns a record of every field it
+// set, in the order they were set.
+func FromMapWithAudit(m map[string]interface{}, dest interface{}, opts ...Option) ([]DecodeRecord, error) {
+	d := newDecoder(DefaultTag, DefaultTag, newOptions(opts))
+	d.audit = true
+	err := d.decodeRoot(m, dest)
+	return d.records, err
+}
+
+func (d *decoder) record(name string, key string, raw interface{}, set interface{}) {
+	if d.audit {
+		d.records = append(d.records, DecodeRecord{Field: name, SourceKey: key, RawValue: raw, SetValue: set})
+	}
+}
+
+func fieldName(f interface{}) string {
+	switch f := f.(type) {
+	case Field:
+		return f.Name()
+	case *initializerAdapter:
+		return fieldName(f.FieldAdapter)
+	case *mapInitializerAdapter:
+		return f.initializer.target.Name()
+	}
+
+	return ""
+}
@@ -0,0 +1,39 @@
+package mapsmith
+
+import (
+	"reflect"
+	"testing"
+)
+
+type audited struct {
+	Name  string                 `map:"name"`
+	Count int                    `map:"count"`
+	Extra map[string]interface{} `map:",inline"`
+}
+
+func TestFromMapWithAudit(t *testing.T) {
+	var dest audited
+	records, err := FromMapWithAudit(map[string]interface{}{"name": "a", "count": 2.0, "other": true}, &dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bySource := make(map[string]DecodeRecord, len(records))
+	for _, r := range records {
+		bySource[r.SourceKey] = r
+	}
+
+	want := map[string]DecodeRecord{
+		"name":  {Field: "Name", SourceKey: "name", RawValue: "a", SetValue: "a"},
+		"count": {Field: "Count", SourceKey: "count", RawValue: 2.0, SetValue: 2},
+		"other": {Field: "Extra", SourceKey: "other", RawValue: true, SetValue: true},
+	}
+
+	if len(records) != len(want) || !reflect.DeepEqual(bySource, want) {
+		t.Fatalf("records = %+v, want %+v", records, want)
+	}
+
+	if records, _ := FromMapWithAudit(map[string]interface{}{}, &audited{}); len(records) != 0 {
+		t.Fatalf("records for an empty source: %+v", records)
+	}
+}
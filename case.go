@@ -0,0 +1,29 @@
+package mapsmith
+
+import (
+	"strings"
+	"unicode"
+)
+
+// SnakeCase converts a Go identifier such as "UserID" or "httpPort" to
+// snake_case ("user_id", "http_port"). Keys already in snake_case are
+// returned unchanged.
+func SnakeCase(s string) string {
+	runes := []rune(s)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			prevLower := i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]))
+			nextLower := i > 0 && i+1 < len(runes) && unicode.IsUpper(runes[i-1]) && unicode.IsLower(runes[i+1])
+			if (prevLower || nextLower) && runes[i-1] != '_' {
+				b.WriteByte('_')
+			}
+
+			r = unicode.ToLower(r)
+		}
+
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
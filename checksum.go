@@ -0,0 +1,50 @@
+package mapsmith
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// checksum hashes the JSON form of m, which encoding/json emits with sorted
+// keys at every level.
+func checksum(m map[string]interface{}, o *options) (string, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return "", fmt.Errorf("mapsmith: checksum: %w", err)
+	}
+
+	h := o.checksumFn()
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func verifyChecksum(m map[string]interface{}, o *options) (map[string]interface{}, error) {
+	raw, ok := m[o.checksumKey]
+	if !ok {
+		return nil, fmt.Errorf("mapsmith: checksum key %q missing", o.checksumKey)
+	}
+
+	expected, ok := raw.(string)
+	if !ok {
+		return nil, fmt.Errorf("mapsmith: checksum key %q holds %T, not a string", o.checksumKey, raw)
+	}
+
+	stripped := make(map[string]interface{}, len(m)-1)
+	for k, v := range m {
+		if k != o.checksumKey {
+			stripped[k] = v
+		}
+	}
+
+	actual, err := checksum(stripped, o)
+	if err != nil {
+		return nil, err
+	}
+
+	if actual != expected {
+		return nil, fmt.Errorf("mapsmith: checksum mismatch: expected %s, got %s", expected, actual)
+	}
+
+	return stripped, nil
+}
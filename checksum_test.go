@@ -0,0 +1,38 @@
+package mapsmith
+
+import (
+	"crypto/sha1"
+	"testing"
+)
+
+func TestChecksum(t *testing.T) {
+	a, err := ToMapE(basic{"a", 1}, WithChecksumKey("sum"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := ToMapE(&basic{"a", 1}, WithChecksumKey("sum"))
+	c, _ := ToMapE(basic{"a", 2}, WithChecksumKey("sum"))
+	if a["sum"] == nil || a["sum"] != b["sum"] {
+		t.Fatalf("equal structs got checksums %v and %v", a["sum"], b["sum"])
+	}
+
+	if a["sum"] == c["sum"] {
+		t.Fatal("different structs got the same checksum")
+	}
+
+	short, _ := ToMapE(basic{"a", 1}, WithChecksumKey("sum"), WithChecksumHash(sha1.New))
+	if len(short["sum"].(string)) != 40 || short["sum"] == a["sum"] {
+		t.Fatalf("WithChecksumHash ignored: %v", short["sum"])
+	}
+
+	var got basic
+	if err := FromMapE(a, &got, WithChecksumKey("sum")); err != nil || got != (basic{"a", 1}) {
+		t.Fatalf("verified decode = %+v, %v", got, err)
+	}
+
+	a["count"] = 9
+	if err := FromMapE(a, &basic{}, WithChecksumKey("sum")); err == nil {
+		t.Fatal("tampered map decoded")
+	}
+}
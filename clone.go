@@ -0,0 +1,169 @@
+package mapsmith
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Clone copies src into dest, a pointer to a value of src's type, by encoding
+// src to a map and decoding that map into dest with the same options. Only
+// mapped fields are copied and dest shares no pointers, maps or slices with
+// src. Secret fields are copied unredacted. Fields src omits, such as empty
+// omitempty fields, decode as absent, so their defaults apply. A struct
+// reached through a mapped field that has no mapped fields of its own and no
+// converter would come back zero, so Clone fails on one instead.
+func Clone(src interface{}, dest interface{}, opts ...Option) error {
+	st := reflect.TypeOf(src)
+	dv := reflect.ValueOf(dest)
+	if st == nil || !isStructType(st) {
+		return fmt.Errorf("mapsmith: cannot clone %T", src)
+	}
+
+	if dv.Kind() != reflect.Ptr || dv.IsNil() || dv.Type().Elem() != baseType(st) {
+		return fmt.Errorf("mapsmith: cannot clone %T into %T", src, dest)
+	}
+
+	if err := checkLossless(st, DefaultTag, DefaultTag, newOptions(opts)); err != nil {
+		return fmt.Errorf("mapsmith: cannot clone %T: %w", src, err)
+	}
+
+	m, err := ToMapUnredacted(src, opts...)
+	if err != nil {
+		return err
+	}
+
+	dv.Elem().Set(reflect.Zero(dv.Type().Elem()))
+	return FromMapE(copyValue(reflect.ValueOf(m)).Interface().(map[string]interface{}), dest, opts...)
+}
+
+// Transcode copies src into dest, which may be of a different struct type,
+// by encoding src under srcTag and decoding the result under destTag, so
+// fields are matched by their mapped keys. Keys dest doesn't map go to its
+// catch-all if it has one and are otherwise dropped, or reported as
+// ErrUnknownKey with WithDisallowUnknownKeys. Secret fields are copied
+// unredacted. Like Clone, it fails on a struct that would encode as an empty
+// map.
+func Transcode(src interface{}, dest interface{}, srcTag string, destTag string, opts ...Option) error {
+	st := reflect.TypeOf(src)
+	if st == nil || !isStructType(st) {
+		return fmt.Errorf("mapsmith: cannot transcode %T", src)
+	}
+
+	if err := checkLossless(st, srcTag, srcTag, newOptions(opts)); err != nil {
+		return fmt.Errorf("mapsmith: cannot transcode %T: %w", src, err)
+	}
+
+	m, err := TaggedToMapE(src, srcTag, srcTag, append(opts, withUnredacted())...)
+	if err != nil {
+		return err
+	}
+
+	return TaggedFromMapE(m, dest, destTag, destTag, opts...)
+}
+
+// copyValue returns a copy of v with fresh storage for every pointer, map and
+// slice it reaches.
+func copyValue(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+
+		c := reflect.New(v.Type().Elem())
+		c.Elem().Set(copyValue(v.Elem()))
+		return c
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+
+		c := reflect.New(v.Type()).Elem()
+		c.Set(copyValue(v.Elem()))
+		return c
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			c.SetMapIndex(iter.Key(), copyValue(iter.Value()))
+		}
+
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(copyValue(v.Index(i)))
+		}
+
+		return c
+	case reflect.Array:
+		c := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(copyValue(v.Index(i)))
+		}
+
+		return c
+	}
+
+	return v
+}
+
+// checkLossless fails if t, or a struct type reached through its mapped
+// fields, would encode as an empty map for want of mapped fields, a
+// converter or a ToMapsmith method.
+func checkLossless(t reflect.Type, nameTag string, filterTag string, o *options) error {
+	return checkMapped(baseType(t), "", nameTag, filterTag, o, make(map[reflect.Type]bool))
+}
+
+func checkMapped(t reflect.Type, path string, nameTag string, filterTag string, o *options, seen map[reflect.Type]bool) error {
+	if seen[t] || o.jsonValues {
+		return nil
+	}
+
+	seen[t] = true
+	if _, ok := o.converter(t); ok || reflect.PtrTo(t).Implements(mapMarshalerType) {
+		return nil
+	}
+
+	info, err := getMappings(reflect.New(t).Interface(), nameTag, filterTag, o)
+	if err != nil {
+		return err
+	}
+
+	if len(info.Fields) == 0 && info.Extra == nil {
+		if path == "" {
+			return fmt.Errorf("%s has no mapped fields", t)
+		}
+
+		return fmt.Errorf("field %q: %s has no mapped fields", path, t)
+	}
+
+	for _, k := range info.keys(true) {
+		if info.flags[k].Contains("whole") {
+			continue
+		}
+
+		ft := fieldType(info.Fields[k])
+		for ft.Kind() == reflect.Ptr || ft.Kind() == reflect.Slice || ft.Kind() == reflect.Array || ft.Kind() == reflect.Map {
+			ft = ft.Elem()
+		}
+
+		if ft.Kind() != reflect.Struct {
+			continue
+		}
+
+		if err := checkMapped(ft, joinPath(path, k), nameTag, filterTag, o, seen); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
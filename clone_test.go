@@ -0,0 +1,116 @@
+package mapsmith
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type cloneable struct {
+	Base  ExportedBase      `map:",inline"`
+	Tags  []string          `map:"tags"`
+	Attrs map[string]string `map:"attrs"`
+	At    time.Time         `map:"at"`
+}
+
+type opaque struct {
+	hidden int
+}
+
+func TestClone(t *testing.T) {
+	src := cloneable{
+		Base:  ExportedBase{1, "a"},
+		Tags:  []string{"x"},
+		Attrs: map[string]string{"k": "v"},
+		At:    time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+
+	var dest cloneable
+	if err := Clone(src, &dest); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(dest, src) {
+		t.Fatalf("Clone = %+v, want %+v", dest, src)
+	}
+
+	dest.Tags[0] = "y"
+	dest.Attrs["k"] = "w"
+	if src.Tags[0] != "x" || src.Attrs["k"] != "v" {
+		t.Fatalf("clone aliases its source: %+v", src)
+	}
+
+	if err := Clone(src, &basic{}); err == nil {
+		t.Fatal("Clone into a different type accepted")
+	}
+}
+
+func TestCloneFailsOnUnmappedStruct(t *testing.T) {
+	type holder struct {
+		O opaque `map:"o"`
+	}
+
+	var dest holder
+	err := Clone(holder{opaque{1}}, &dest)
+	if err == nil || !strings.Contains(err.Error(), `field "o"`) {
+		t.Fatalf("err = %v, want an error naming field o", err)
+	}
+}
+
+func TestTranscode(t *testing.T) {
+	var dest inlineOuter
+	if err := Transcode(promotingOuter{ExportedBase{1, "a"}, 2}, &dest, DefaultTag, DefaultTag); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := (inlineOuter{ExportedBase{1, "a"}, 2}); dest != want {
+		t.Fatalf("Transcode = %+v, want %+v", dest, want)
+	}
+
+	type source struct {
+		ID    int    `json:"id"`
+		Label string `json:"label"`
+	}
+
+	type target struct {
+		ID    int    `db:"id"`
+		Label string `db:"label"`
+	}
+
+	var tdest target
+	if err := Transcode(source{7, "l"}, &tdest, "json", "db"); err != nil || tdest != (target{7, "l"}) {
+		t.Fatalf("Transcode across tags = %+v, %v", tdest, err)
+	}
+
+	type wider struct {
+		ID    int    `json:"id"`
+		Label string `json:"label"`
+		Owner string `json:"owner"`
+	}
+
+	type narrowWithExtra struct {
+		ID    int                    `db:"id"`
+		Extra map[string]interface{} `db:",inline"`
+	}
+
+	var cdest narrowWithExtra
+	if err := Transcode(wider{7, "l", "o"}, &cdest, "json", "db"); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := (map[string]interface{}{"label": "l", "owner": "o"}); cdest.ID != 7 || !reflect.DeepEqual(cdest.Extra, want) {
+		t.Fatalf("unmapped keys not sent to the catch-all: %+v", cdest)
+	}
+
+	tdest = target{}
+	if err := Transcode(wider{7, "l", "o"}, &tdest, "json", "db"); err != nil || tdest != (target{7, "l"}) {
+		t.Fatalf("unmapped keys not dropped: %+v, %v", tdest, err)
+	}
+
+	err := Transcode(wider{7, "l", "o"}, &target{}, "json", "db", WithDisallowUnknownKeys())
+	if !errors.Is(err, ErrUnknownKey) || !strings.Contains(err.Error(), "owner") {
+		t.Fatalf("err = %v, want ErrUnknownKey for owner", err)
+	}
+}
@@ -0,0 +1,366 @@
+package mapsmith
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// parseString parses s as a value of type t. Types without a string form are
+// returned as s unchanged when assignable, so the caller can decide.
+func parseString(s string, t reflect.Type) (interface{}, error) {
+	if t.Kind() == reflect.Ptr {
+		v, err := parseString(s, t.Elem())
+		if err != nil {
+			return nil, err
+		}
+
+		next := reflect.ValueOf(v)
+		if !next.Type().ConvertibleTo(t.Elem()) {
+			return v, nil
+		}
+
+		p := reflect.New(t.Elem())
+		p.Elem().Set(next.Convert(t.Elem()))
+		return p.Interface(), nil
+	}
+
+	rv := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.String:
+		rv.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse %q as %s", s, t)
+		}
+
+		rv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if t == durationType {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse %q as %s", s, t)
+			}
+
+			rv.SetInt(int64(d))
+			break
+		}
+
+		n, err := strconv.ParseInt(s, 10, t.Bits())
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse %q as %s", s, t)
+		}
+
+		rv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(s, 10, t.Bits())
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse %q as %s", s, t)
+		}
+
+		rv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, t.Bits())
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse %q as %s", s, t)
+		}
+
+		rv.SetFloat(f)
+	case reflect.Slice:
+		if !isBytesType(t) {
+			return s, nil
+		}
+
+		rv.SetBytes([]byte(s))
+	default:
+		return s, nil
+	}
+
+	return rv.Interface(), nil
+}
+
+// asType converts v to t, allocating when t is a pointer to v's type.
+func asType(v interface{}, t reflect.Type) interface{} {
+	rv := reflect.ValueOf(v)
+	if t.Kind() == reflect.Ptr && rv.Type() != t {
+		p := reflect.New(t.Elem())
+		p.Elem().Set(rv.Convert(t.Elem()))
+		return p.Interface()
+	}
+
+	return rv.Convert(t).Interface()
+}
+
+// numericBool interprets a number, or a string holding one, as a bool. The
+// second result is false when v is not numeric. With strict, anything other
+// than 0 or 1 is an error.
+func numericBool(v interface{}, strict bool) (bool, bool, error) {
+	var f float64
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		f = float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		f = float64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		f = rv.Float()
+	case reflect.String:
+		parsed, err := strconv.ParseFloat(rv.String(), 64)
+		if err != nil {
+			return false, false, nil
+		}
+
+		f = parsed
+	default:
+		return false, false, nil
+	}
+
+	if strict && f != 0 && f != 1 {
+		return false, true, fmt.Errorf("ambiguous boolean value %v", v)
+	}
+
+	return f != 0, true, nil
+}
+
+// parseBoolString reports whether s is one of truthy or falsy, falling back
+// to strconv.ParseBool for anything in neither.
+func parseBoolString(s string, truthy, falsy []string) (bool, error) {
+	for _, t := range truthy {
+		if strings.EqualFold(s, t) {
+			return true, nil
+		}
+	}
+
+	for _, f := range falsy {
+		if strings.EqualFold(s, f) {
+			return false, nil
+		}
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, fmt.Errorf("cannot parse %q as bool", s)
+	}
+
+	return b, nil
+}
+
+// assignable returns v as a value that can be stored in a t, converting
+// between numeric kinds or between types sharing a kind.
+func assignable(v interface{}, t reflect.Type) (reflect.Value, error) {
+	next := reflect.ValueOf(v)
+	if !next.IsValid() {
+		return reflect.Zero(t), nil
+	}
+
+	if next.Type().AssignableTo(t) {
+		return next, nil
+	}
+
+	if isNumberKind(next.Kind()) && isNumberKind(t.Kind()) {
+		return convertNumber(next, t)
+	}
+
+	if next.Type().ConvertibleTo(t) && next.Kind() == t.Kind() {
+		return next.Convert(t), nil
+	}
+
+	return reflect.Value{}, fmt.Errorf("cannot use %T as %s", v, t)
+}
+
+// convertNumber converts between numeric kinds, failing rather than wrapping
+// or truncating when v can't be represented exactly in t.
+func convertNumber(v reflect.Value, t reflect.Type) (reflect.Value, error) {
+	out := reflect.New(t).Elem()
+	fail := func() (reflect.Value, error) {
+		return reflect.Value{}, fmt.Errorf("value %v overflows %s", v.Interface(), t)
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		switch v.Kind() {
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			if v.Uint() > math.MaxInt64 {
+				return fail()
+			}
+
+			n = int64(v.Uint())
+		case reflect.Float32, reflect.Float64:
+			f := v.Float()
+			if f != math.Trunc(f) {
+				return reflect.Value{}, fmt.Errorf("value %v is not an integer", f)
+			}
+
+			if f < math.MinInt64 || f >= math.MaxInt64 {
+				return fail()
+			}
+
+			n = int64(f)
+		default:
+			n = v.Int()
+		}
+
+		if out.OverflowInt(n) {
+			return fail()
+		}
+
+		out.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var n uint64
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if v.Int() < 0 {
+				return fail()
+			}
+
+			n = uint64(v.Int())
+		case reflect.Float32, reflect.Float64:
+			f := v.Float()
+			if f != math.Trunc(f) {
+				return reflect.Value{}, fmt.Errorf("value %v is not an integer", f)
+			}
+
+			if f < 0 || f >= math.MaxUint64 {
+				return fail()
+			}
+
+			n = uint64(f)
+		default:
+			n = v.Uint()
+		}
+
+		if out.OverflowUint(n) {
+			return fail()
+		}
+
+		out.SetUint(n)
+	default:
+		var f float64
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			f = float64(v.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			f = float64(v.Uint())
+		default:
+			f = v.Float()
+		}
+
+		if out.OverflowFloat(f) {
+			return fail()
+		}
+
+		out.SetFloat(f)
+	}
+
+	return out, nil
+}
+
+// isCharKind reports whether k is the kind of rune or byte, whose fields the
+// char flag maps to single-character strings.
+func isCharKind(k reflect.Kind) bool {
+	return k == reflect.Int32 || k == reflect.Uint8
+}
+
+func encodeChar(v reflect.Value) string {
+	if v.Kind() == reflect.Uint8 {
+		return string(rune(v.Uint()))
+	}
+
+	return string(rune(v.Int()))
+}
+
+// decodeChar reads a string of exactly one character as a rune or byte of
+// type t, or a pointer to one. Bytes only hold characters up to U+00FF.
+func decodeChar(s string, t reflect.Type) (interface{}, error) {
+	r, size := utf8.DecodeRuneInString(s)
+	if size == 0 || size != len(s) || r == utf8.RuneError {
+		return nil, fmt.Errorf("expected a single character, got %q", s)
+	}
+
+	ptr := reflect.New(baseType(t))
+	out := ptr.Elem()
+	if out.Kind() == reflect.Uint8 {
+		if r > 0xff {
+			return nil, fmt.Errorf("character %q does not fit in a byte", r)
+		}
+
+		out.SetUint(uint64(r))
+	} else {
+		out.SetInt(int64(r))
+	}
+
+	if t.Kind() == reflect.Ptr {
+		return ptr.Interface(), nil
+	}
+
+	return out.Interface(), nil
+}
+
+// stripQuotes removes one pair of matching surrounding single or double
+// quotes.
+func stripQuotes(s string) string {
+	if len(s) >= 2 && s[0] == s[len(s)-1] && (s[0] == '"' || s[0] == '\'') {
+		return s[1 : len(s)-1]
+	}
+
+	return s
+}
+
+// splitString decodes a delimited string into a slice of t, parsing each
+// element from its string form. An empty string yields an empty slice rather
+// than one empty element.
+func splitString(s string, sep string, trim bool, t reflect.Type) (interface{}, error) {
+	if sep == "" {
+		sep = ","
+	}
+
+	var parts []string
+	if s != "" {
+		parts = strings.Split(s, sep)
+	}
+
+	items := reflect.MakeSlice(t, len(parts), len(parts))
+	for i, part := range parts {
+		if trim {
+			part = strings.TrimSpace(part)
+		}
+
+		item, err := parseString(part, t.Elem())
+		if err != nil {
+			return nil, err
+		}
+
+		next, err := assignable(item, t.Elem())
+		if err != nil {
+			return nil, err
+		}
+
+		items.Index(i).Set(next)
+	}
+
+	return items.Interface(), nil
+}
+
+func joinSlice(v interface{}, sep string) string {
+	if sep == "" {
+		sep = ","
+	}
+
+	rv := reflect.ValueOf(v)
+	parts := make([]string, 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		if part, ok := valueString(rv.Index(i)); ok {
+			parts = append(parts, part)
+		}
+	}
+
+	return strings.Join(parts, sep)
+}
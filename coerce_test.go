@@ -0,0 +1,109 @@
+package mapsmith
+
+import "testing"
+
+type flagged struct {
+	On  bool  `map:"on"`
+	Ptr *bool `map:"ptr"`
+}
+
+func TestNumericBools(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    interface{}
+		strict bool
+		want   bool
+		ok     bool
+	}{
+		{"int one", 1, true, true, true},
+		{"int zero", 0, true, false, true},
+		{"float one", 1.0, true, true, true},
+		{"float zero", 0.0, true, false, true},
+		{"string one", "1", true, true, true},
+		{"string zero", "0", true, false, true},
+		{"strict ambiguous int", 2, true, false, false},
+		{"strict ambiguous float", 0.5, true, false, false},
+		{"strict ambiguous string", "7", true, false, false},
+		{"loose nonzero", 2, false, true, true},
+		{"loose fraction", 0.5, false, true, true},
+		{"not numeric", "maybe", false, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got flagged
+			err := FromMapE(map[string]interface{}{"on": tt.src, "ptr": tt.src}, &got, WithNumericBools(tt.strict))
+			if (err == nil) != tt.ok {
+				t.Fatalf("err = %v, want ok = %v", err, tt.ok)
+			}
+
+			if tt.ok && (got.On != tt.want || got.Ptr == nil || *got.Ptr != tt.want) {
+				t.Fatalf("got %v, %v, want %v", got.On, got.Ptr, tt.want)
+			}
+		})
+	}
+
+	if err := FromMapE(map[string]interface{}{"on": 1}, &flagged{}); err == nil {
+		t.Fatal("number decoded into bool without WithNumericBools")
+	}
+}
+
+func TestNumericCoercion(t *testing.T) {
+	type numbers struct {
+		I   int     `map:"i"`
+		I8  int8    `map:"i8"`
+		U   uint16  `map:"u"`
+		F32 float32 `map:"f32"`
+	}
+
+	var got numbers
+	err := FromMapE(map[string]interface{}{"i": 3.0, "i8": -8.0, "u": 7, "f32": 1.5}, &got)
+	if err != nil || got != (numbers{3, -8, 7, 1.5}) {
+		t.Fatalf("FromMapE = %+v, %v", got, err)
+	}
+
+	for _, src := range []map[string]interface{}{
+		{"i8": 1e20},
+		{"i8": 200.0},
+		{"u": -1},
+		{"i": 1.5},
+	} {
+		if err := FromMapE(src, &numbers{}); err == nil {
+			t.Errorf("FromMapE(%v) accepted a value the field can't hold", src)
+		}
+	}
+}
+
+func TestBoolStrings(t *testing.T) {
+	opt := WithBoolStrings([]string{"t", "enabled"}, []string{"f", "disabled"})
+	tests := []struct {
+		src  string
+		want bool
+		ok   bool
+	}{
+		{"t", true, true},
+		{"ENABLED", true, true},
+		{"f", false, true},
+		{"Disabled", false, true},
+		{"true", true, true},
+		{"0", false, true},
+		{"maybe", false, false},
+	}
+
+	for _, tt := range tests {
+		got := flagged{On: !tt.want}
+		err := FromMapE(map[string]interface{}{"on": tt.src, "ptr": tt.src}, &got, opt)
+		if (err == nil) != tt.ok {
+			t.Errorf("%q: err = %v", tt.src, err)
+			continue
+		}
+
+		if tt.ok && (got.On != tt.want || got.Ptr == nil || *got.Ptr != tt.want) {
+			t.Errorf("%q: got %+v", tt.src, got)
+		}
+	}
+
+	if err := FromMapE(map[string]interface{}{"on": "enabled"}, &flagged{}); err == nil {
+		t.Error("custom truthy string accepted without WithBoolStrings")
+	}
+}
@@ -0,0 +1,71 @@
+package mapsmith
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	complexRealKey = "real"
+	complexImagKey = "imag"
+)
+
+func isComplexKind(k reflect.Kind) bool {
+	return k == reflect.Complex64 || k == reflect.Complex128
+}
+
+func encodeComplex(rv reflect.Value, format ComplexFormat) interface{} {
+	c := rv.Complex()
+	if format == ComplexString {
+		return strings.Trim(strconv.FormatComplex(c, 'g', -1, rv.Type().Bits()), "()")
+	}
+
+	return map[string]interface{}{
+		complexRealKey: real(c),
+		complexImagKey: imag(c),
+	}
+}
+
+// decodeComplex reads a complex value of type t from a {"real", "imag"} map
+// or from a string such as "1+2i". The second result is false for any other
+// source.
+func decodeComplex(v interface{}, t reflect.Type) (interface{}, bool, error) {
+	var c complex128
+	switch v := v.(type) {
+	case string:
+		parsed, err := strconv.ParseComplex(v, baseType(t).Bits())
+		if err != nil {
+			return nil, true, fmt.Errorf("cannot parse %q as %s", v, t)
+		}
+
+		c = parsed
+	case map[string]interface{}:
+		re, ok := v[complexRealKey]
+		if !ok {
+			return nil, true, fmt.Errorf("expected key %q for %s", complexRealKey, t)
+		}
+
+		im, ok := v[complexImagKey]
+		if !ok {
+			return nil, true, fmt.Errorf("expected key %q for %s", complexImagKey, t)
+		}
+
+		r, err := assignable(re, reflect.TypeOf(float64(0)))
+		if err != nil {
+			return nil, true, err
+		}
+
+		i, err := assignable(im, reflect.TypeOf(float64(0)))
+		if err != nil {
+			return nil, true, err
+		}
+
+		c = complex(r.Float(), i.Float())
+	default:
+		return nil, false, nil
+	}
+
+	return asType(c, t), true, nil
+}
@@ -0,0 +1,138 @@
+package mapsmith
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+type converter struct {
+	to   func(v interface{}) interface{}
+	from func(v interface{}, t reflect.Type) (interface{}, error)
+}
+
+type interfaceConverter struct {
+	iface reflect.Type
+	converter
+}
+
+type converterRegistry struct {
+	mu     sync.RWMutex
+	exact  map[reflect.Type]converter
+	ifaces []interfaceConverter
+}
+
+// defaultConverters holds the global converters, starting with time.Time to
+// and from RFC 3339 strings so that times aren't encoded as empty maps.
+var defaultConverters = newTimeRegistry()
+
+func newTimeRegistry() *converterRegistry {
+	r := &converterRegistry{exact: make(map[reflect.Type]converter)}
+	r.register(timeType, func(v interface{}) interface{} {
+		return v.(time.Time).Format(time.RFC3339Nano)
+	}, func(v interface{}) (interface{}, error) {
+		switch tv := v.(type) {
+		case time.Time:
+			return tv, nil
+		case string:
+			return time.Parse(time.RFC3339, tv)
+		}
+
+		return nil, fmt.Errorf("cannot use %T as %s", v, timeType)
+	})
+
+	return r
+}
+
+// RegisterConverter makes values of type t encode through to and decode
+// through from instead of being reflected field by field.
+func RegisterConverter(t reflect.Type, to func(v interface{}) interface{}, from func(v interface{}) (interface{}, error)) {
+	defaultConverters.register(t, to, from)
+}
+
+// RegisterInterfaceConverter applies to and from to every type implementing
+// iface. from receives the concrete destination type to build. A converter
+// registered for the exact type always wins; among interface converters the
+// first registered match wins.
+func RegisterInterfaceConverter(iface reflect.Type, to func(v interface{}) interface{}, from func(v interface{}, t reflect.Type) (interface{}, error)) {
+	defaultConverters.registerInterface(iface, to, from)
+}
+
+// Converters is a converter registry scoped to the calls it is passed to
+// with WithConverters. Its converters are consulted before the global ones.
+type Converters struct {
+	r converterRegistry
+}
+
+// NewConverters returns an empty registry. Times already convert to and from
+// RFC 3339 strings through the global converters.
+func NewConverters() *Converters {
+	return &Converters{r: converterRegistry{exact: make(map[reflect.Type]converter)}}
+}
+
+// Register is RegisterConverter for this registry only.
+func (c *Converters) Register(t reflect.Type, to func(v interface{}) interface{}, from func(v interface{}) (interface{}, error)) {
+	c.r.register(t, to, from)
+}
+
+// RegisterInterface is RegisterInterfaceConverter for this registry only.
+func (c *Converters) RegisterInterface(iface reflect.Type, to func(v interface{}) interface{}, from func(v interface{}, t reflect.Type) (interface{}, error)) {
+	c.r.registerInterface(iface, to, from)
+}
+
+func (r *converterRegistry) register(t reflect.Type, to func(v interface{}) interface{}, from func(v interface{}) (interface{}, error)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.exact[t] = converter{
+		to: to,
+		from: func(v interface{}, _ reflect.Type) (interface{}, error) {
+			return from(v)
+		},
+	}
+}
+
+func (r *converterRegistry) registerInterface(iface reflect.Type, to func(v interface{}) interface{}, from func(v interface{}, t reflect.Type) (interface{}, error)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ifaces = append(r.ifaces, interfaceConverter{
+		iface:     iface,
+		converter: converter{to: to, from: from},
+	})
+}
+
+func (r *converterRegistry) lookup(t reflect.Type) (converter, bool) {
+	if t == nil {
+		return converter{}, false
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if c, ok := r.exact[t]; ok {
+		return c, true
+	}
+
+	if t.Kind() == reflect.Interface {
+		return converter{}, false
+	}
+
+	for _, ic := range r.ifaces {
+		if t.Implements(ic.iface) {
+			return ic.converter, true
+		}
+	}
+
+	return converter{}, false
+}
+
+// converter finds the converter for t, trying the registry passed with
+// WithConverters before the global one.
+func (o *options) converter(t reflect.Type) (converter, bool) {
+	if o.converters != nil {
+		if c, ok := o.converters.r.lookup(t); ok {
+			return c, true
+		}
+	}
+
+	return defaultConverters.lookup(t)
+}
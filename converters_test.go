@@ -0,0 +1,116 @@
+package mapsmith
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type timed struct {
+	At    time.Time  `map:"at"`
+	Maybe *time.Time `map:"maybe"`
+}
+
+func TestTimeConvertsByDefault(t *testing.T) {
+	at := time.Date(2024, 3, 1, 12, 30, 0, 500, time.UTC)
+	m := ToMap(timed{At: at, Maybe: &at})
+	if m["at"] != "2024-03-01T12:30:00.0000005Z" || m["maybe"] != m["at"] {
+		t.Fatalf("ToMap = %v", m)
+	}
+
+	var got timed
+	if err := FromMapE(m, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if !got.At.Equal(at) || got.Maybe == nil || !got.Maybe.Equal(at) {
+		t.Fatalf("FromMapE = %+v", got)
+	}
+}
+
+func TestTimeFlagsBeatConverter(t *testing.T) {
+	type epoch struct {
+		At time.Time `map:"at,unix"`
+	}
+
+	var e epoch
+	if err := FromMapE(map[string]interface{}{"at": 60}, &e); err != nil || e.At.Unix() != 60 {
+		t.Fatalf("unix decode = %v, %v", e.At, err)
+	}
+
+	var l timed
+	err := FromMapE(map[string]interface{}{"at": "01/02/2006"}, &l, WithTimeLayouts("01/02/2006"))
+	if err != nil || l.At.Year() != 2006 {
+		t.Fatalf("layout decode = %v, %v", l.At, err)
+	}
+}
+
+type celsius float64
+
+func TestWithConverters(t *testing.T) {
+	type reading struct {
+		Temp celsius `map:"temp"`
+	}
+
+	c := NewConverters()
+	c.Register(reflect.TypeOf(celsius(0)), func(v interface{}) interface{} {
+		return fmt.Sprintf("%.1fC", float64(v.(celsius)))
+	}, func(v interface{}) (interface{}, error) {
+		var f float64
+		_, err := fmt.Sscanf(strings.TrimSuffix(v.(string), "C"), "%g", &f)
+		return celsius(f), err
+	})
+
+	m := ToMap(reading{21.5}, WithConverters(c))
+	if m["temp"] != "21.5C" {
+		t.Fatalf("ToMap = %v", m)
+	}
+
+	var got reading
+	if err := FromMapE(m, &got, WithConverters(c)); err != nil || got.Temp != 21.5 {
+		t.Fatalf("FromMapE = %+v, %v", got, err)
+	}
+
+	if m := ToMap(reading{21.5}); m["temp"] != celsius(21.5) {
+		t.Fatalf("registry leaked into another call: %v", m)
+	}
+}
+
+type stringer interface {
+	String() string
+}
+
+type color struct {
+	R, G, B uint8
+}
+
+func (c color) String() string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+func TestInterfaceConverter(t *testing.T) {
+	type theme struct {
+		FG color `map:"fg"`
+	}
+
+	c := NewConverters()
+	c.RegisterInterface(reflect.TypeOf((*stringer)(nil)).Elem(), func(v interface{}) interface{} {
+		return v.(stringer).String()
+	}, func(v interface{}, t reflect.Type) (interface{}, error) {
+		var col color
+		_, err := fmt.Sscanf(v.(string), "#%02x%02x%02x", &col.R, &col.G, &col.B)
+		return reflect.ValueOf(col).Convert(t).Interface(), err
+	})
+
+	m := ToMap(theme{color{255, 0, 16}}, WithConverters(c))
+	if m["fg"] != "#ff0010" {
+		t.Fatalf("ToMap = %v", m)
+	}
+
+	var got theme
+	if err := FromMapE(m, &got, WithConverters(c)); err != nil || got.FG != (color{255, 0, 16}) {
+		t.Fatalf("FromMapE = %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,200 @@
+package mapsmith
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// FieldInfo describes one mapped key of a struct, as returned by Describe.
+type FieldInfo struct {
+	// Key is the dotted path of the key, e.g. "db.host". A catch-all is
+	// listed under its parent's path followed by "*".
+	Key  string
+	Type reflect.Type
+	// Flags holds the tag flags in sorted order, e.g. "omitempty" or
+	// "default=80".
+	Flags []string
+	// Default is the value of the default= flag, if any.
+	Default string
+	// Desc is taken from the field's separate `desc` struct tag.
+	Desc     string
+	Required bool
+	CatchAll bool
+}
+
+// Describe lists every key v maps, in sorted order, descending into nested
+// structs. Fields promoted from inline structs are listed under their own
+// keys.
+func Describe(v interface{}, opts ...Option) []FieldInfo {
+	fields, _ := DescribeE(v, opts...)
+	return fields
+}
+
+func DescribeE(v interface{}, opts ...Option) ([]FieldInfo, error) {
+	return TaggedDescribeE(v, DefaultTag, DefaultTag, opts...)
+}
+
+func TaggedDescribeE(v interface{}, nameTag string, filterTag string, opts ...Option) ([]FieldInfo, error) {
+	t := reflect.TypeOf(v)
+	if t == nil || !isStructType(t) {
+		return nil, nil
+	}
+
+	return describe(baseType(t), "", nameTag, filterTag, newOptions(opts), map[reflect.Type]bool{})
+}
+
+func describe(t reflect.Type, path string, nameTag string, filterTag string, o *options, seen map[reflect.Type]bool) ([]FieldInfo, error) {
+	info, err := getMappings(reflect.New(t).Interface(), nameTag, filterTag, o)
+	if err != nil {
+		return nil, err
+	}
+
+	seen[t] = true
+	defer delete(seen, t)
+
+	var fields []FieldInfo
+	for _, key := range info.keys(true) {
+		f := info.Fields[key]
+		flags := info.flags[key]
+		fi := FieldInfo{
+			Key:      joinPath(path, key),
+			Type:     fieldType(f),
+			Flags:    flags.Keys(),
+			Desc:     fieldTag(f, "desc"),
+			Required: flags.Contains("required"),
+		}
+
+		sort.Strings(fi.Flags)
+		fi.Default, _ = flags.Param("default")
+		fields = append(fields, fi)
+
+		nested := baseType(fieldType(f))
+		if nested.Kind() != reflect.Struct || isTimeType(nested) || seen[nested] {
+			continue
+		}
+
+		if _, ok := o.converter(nested); ok {
+			continue
+		}
+
+		inner, err := describe(nested, fi.Key, nameTag, filterTag, o, seen)
+		if err != nil {
+			return nil, err
+		}
+
+		fields = append(fields, inner...)
+	}
+
+	if extra, ok := info.Extra.(*mapInitializerAdapter); ok {
+		target := extra.initializer.target
+		fields = append(fields, FieldInfo{
+			Key:      joinPath(path, "*"),
+			Type:     fieldType(target),
+			Desc:     target.Tag("desc"),
+			CatchAll: true,
+		})
+	}
+
+	return fields, nil
+}
+
+// SampleMap returns a template of the map v's type encodes to: each key holds
+// its default= value when declared, or else an empty value of the field's
+// kind, with nested structs as nested sample maps.
+func SampleMap(v interface{}, opts ...Option) map[string]interface{} {
+	m, _ := SampleMapE(v, opts...)
+	return m
+}
+
+func SampleMapE(v interface{}, opts ...Option) (map[string]interface{}, error) {
+	return TaggedSampleMapE(v, DefaultTag, DefaultTag, opts...)
+}
+
+func TaggedSampleMapE(v interface{}, nameTag string, filterTag string, opts ...Option) (map[string]interface{}, error) {
+	t := reflect.TypeOf(v)
+	if t == nil || !isStructType(t) {
+		return nil, nil
+	}
+
+	return sample(baseType(t), nameTag, filterTag, newOptions(opts), map[reflect.Type]bool{})
+}
+
+func sample(t reflect.Type, nameTag string, filterTag string, o *options, seen map[reflect.Type]bool) (map[string]interface{}, error) {
+	info, err := getMappings(reflect.New(t).Interface(), nameTag, filterTag, o)
+	if err != nil {
+		return nil, err
+	}
+
+	seen[t] = true
+	defer delete(seen, t)
+
+	m := make(map[string]interface{}, len(info.Fields))
+	for _, key := range info.keys(true) {
+		f := info.Fields[key]
+		flags := info.flags[key]
+		value, err := sampleValue(fieldType(f), flags, nameTag, filterTag, o, seen)
+		if err != nil {
+			return nil, fmt.Errorf("mapsmith: field %q: %w", key, err)
+		}
+
+		if group, ok := flags.Param("group"); ok && group != "" {
+			nested, ok := m[group].(map[string]interface{})
+			if !ok {
+				nested = make(map[string]interface{})
+				m[group] = nested
+			}
+
+			nested[key] = value
+			continue
+		}
+
+		m[key] = value
+	}
+
+	return m, nil
+}
+
+func sampleValue(t reflect.Type, flags stringSet, nameTag string, filterTag string, o *options, seen map[reflect.Type]bool) (interface{}, error) {
+	if literal, ok := flags.Param("default"); ok {
+		v, err := parseString(literal, baseType(t))
+		if err != nil {
+			return nil, fmt.Errorf("invalid default: %w", err)
+		}
+
+		return v, nil
+	}
+
+	base := baseType(t)
+	switch {
+	case base.Kind() == reflect.Struct && !isTimeType(base):
+		if _, ok := o.converter(base); ok {
+			break
+		}
+
+		if seen[base] {
+			return map[string]interface{}{}, nil
+		}
+
+		return sample(base, nameTag, filterTag, o, seen)
+	case base.Kind() == reflect.Slice:
+		return reflect.MakeSlice(base, 0, 0).Interface(), nil
+	case base.Kind() == reflect.Map:
+		return reflect.MakeMap(base).Interface(), nil
+	case base.Kind() == reflect.Interface:
+		return nil, nil
+	}
+
+	return reflect.Zero(base).Interface(), nil
+}
+
+func fieldTag(f interface{}, name string) string {
+	switch f := f.(type) {
+	case Field:
+		return f.Tag(name)
+	case *initializerAdapter:
+		return fieldTag(f.FieldAdapter, name)
+	}
+
+	return ""
+}
@@ -0,0 +1,74 @@
+package mapsmith
+
+import (
+	"reflect"
+	"testing"
+)
+
+type auditFields struct {
+	CreatedBy string `map:"created_by"`
+}
+
+type described struct {
+	Name   string                 `map:"name,required" desc:"display name"`
+	Port   int                    `map:"port,omitempty,default=80"`
+	DB     dbConfig               `map:"db"`
+	Audit  auditFields            `map:",inline"`
+	Extras map[string]interface{} `map:",inline" desc:"anything else"`
+}
+
+func TestDescribe(t *testing.T) {
+	var keys []string
+	byKey := make(map[string]FieldInfo)
+	for _, fi := range Describe(described{}) {
+		keys = append(keys, fi.Key)
+		byKey[fi.Key] = fi
+	}
+
+	want := []string{"created_by", "db", "db.host", "db.port", "name", "port", "*"}
+	if !reflect.DeepEqual(keys, want) {
+		t.Fatalf("keys = %v, want %v", keys, want)
+	}
+
+	if fi := byKey["name"]; !fi.Required || fi.Desc != "display name" || fi.Type != reflect.TypeOf("") {
+		t.Errorf("name = %+v", fi)
+	}
+
+	if fi := byKey["port"]; fi.Default != "80" || !reflect.DeepEqual(fi.Flags, []string{"default=80", "omitempty"}) {
+		t.Errorf("port = %+v", fi)
+	}
+
+	if fi := byKey["db.port"]; fi.Type != reflect.TypeOf(0) || fi.Required {
+		t.Errorf("db.port = %+v", fi)
+	}
+
+	if fi := byKey["*"]; !fi.CatchAll || fi.Desc != "anything else" {
+		t.Errorf("catch-all = %+v", fi)
+	}
+}
+
+func TestSampleMap(t *testing.T) {
+	type sampled struct {
+		Name  string    `map:"name"`
+		Port  int       `map:"port,default=80"`
+		Debug bool      `map:"debug"`
+		Tags  []string  `map:"tags"`
+		DB    dbConfig  `map:"db"`
+		Peer  *dbConfig `map:"peer"`
+	}
+
+	got := SampleMap(sampled{})
+	db := map[string]interface{}{"host": "", "port": 0}
+	want := map[string]interface{}{
+		"name":  "",
+		"port":  80,
+		"debug": false,
+		"tags":  []string{},
+		"db":    db,
+		"peer":  db,
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("SampleMap = %#v, want %#v", got, want)
+	}
+}
@@ -0,0 +1,99 @@
+package mapsmith
+
+import (
+	"reflect"
+)
+
+// ToMapDiff encodes only the top-level keys whose values differ between from
+// and to, taking the value from to. A key that was set in from but is zero
+// or omitted in to is written as a tombstone instead, nil unless changed
+// with WithTombstone, so receivers know to clear it.
+func ToMapDiff(from interface{}, to interface{}, opts ...Option) (map[string]interface{}, error) {
+	o := newOptions(opts)
+	before, err := toMap(from, DefaultTag, DefaultTag, o)
+	if err != nil {
+		return nil, err
+	}
+
+	after, err := toMap(to, DefaultTag, DefaultTag, o)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := make(map[string]interface{})
+	for k, v := range after {
+		prev, ok := before[k]
+		if ok && reflect.DeepEqual(prev, v) {
+			continue
+		}
+
+		if ok && isZeroInterface(v) && !isZeroInterface(prev) {
+			diff[k] = o.tombstone
+			continue
+		}
+
+		diff[k] = v
+	}
+
+	for k, prev := range before {
+		if _, ok := after[k]; !ok && !isZeroInterface(prev) {
+			diff[k] = o.tombstone
+		}
+	}
+
+	return diff, nil
+}
+
+// Diff compares two maps key by key. added holds the keys only in new,
+// removed the keys only in old, with their old values, and changed the new
+// values of keys in both whose values differ. Where both values are
+// map[string]interface{} the maps are compared recursively, and each result
+// holds only the nested keys that differ, under the parent key.
+func Diff(old map[string]interface{}, new map[string]interface{}) (added, removed, changed map[string]interface{}) {
+	added = make(map[string]interface{})
+	removed = make(map[string]interface{})
+	changed = make(map[string]interface{})
+	for k, prev := range old {
+		next, ok := new[k]
+		if !ok {
+			removed[k] = prev
+			continue
+		}
+
+		prevMap, prevOK := prev.(map[string]interface{})
+		nextMap, nextOK := next.(map[string]interface{})
+		if prevOK && nextOK {
+			a, r, c := Diff(prevMap, nextMap)
+			if len(a) > 0 {
+				added[k] = a
+			}
+
+			if len(r) > 0 {
+				removed[k] = r
+			}
+
+			if len(c) > 0 {
+				changed[k] = c
+			}
+
+			continue
+		}
+
+		if !reflect.DeepEqual(prev, next) {
+			changed[k] = next
+		}
+	}
+
+	for k, next := range new {
+		if _, ok := old[k]; !ok {
+			added[k] = next
+		}
+	}
+
+	return added, removed, changed
+}
+
+func isZeroInterface(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	return !rv.IsValid() || rv.IsZero()
+}
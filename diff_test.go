@@ -0,0 +1,60 @@
+package mapsmith
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestToMapDiffTombstones(t *testing.T) {
+	type record struct {
+		Name  string `map:"name"`
+		Count int    `map:"count"`
+		Note  string `map:"note,omitempty"`
+	}
+
+	from := record{"a", 5, "n"}
+	to := record{"b", 0, ""}
+
+	got, err := ToMapDiff(from, to)
+	if want := (map[string]interface{}{"name": "b", "count": nil, "note": nil}); err != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("ToMapDiff = %v, %v, want %v", got, err, want)
+	}
+
+	got, err = ToMapDiff(from, to, WithTombstone("__deleted__"))
+	if want := (map[string]interface{}{"name": "b", "count": "__deleted__", "note": "__deleted__"}); err != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("ToMapDiff = %v, %v, want %v", got, err, want)
+	}
+
+	if got, err := ToMapDiff(from, from); err != nil || len(got) != 0 {
+		t.Fatalf("ToMapDiff of equal values = %v, %v", got, err)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	old := map[string]interface{}{
+		"name":   "a",
+		"gone":   1,
+		"server": map[string]interface{}{"host": "h", "tls": map[string]interface{}{"cert": "c", "key": "k"}},
+		"same":   []interface{}{1},
+	}
+
+	new := map[string]interface{}{
+		"name":   "b",
+		"added":  true,
+		"server": map[string]interface{}{"host": "h", "port": 80, "tls": map[string]interface{}{"cert": "d"}},
+		"same":   []interface{}{1},
+	}
+
+	added, removed, changed := Diff(old, new)
+	if want := (map[string]interface{}{"added": true, "server": map[string]interface{}{"port": 80}}); !reflect.DeepEqual(added, want) {
+		t.Errorf("added = %v, want %v", added, want)
+	}
+
+	if want := (map[string]interface{}{"gone": 1, "server": map[string]interface{}{"tls": map[string]interface{}{"key": "k"}}}); !reflect.DeepEqual(removed, want) {
+		t.Errorf("removed = %v, want %v", removed, want)
+	}
+
+	if want := (map[string]interface{}{"name": "b", "server": map[string]interface{}{"tls": map[string]interface{}{"cert": "d"}}}); !reflect.DeepEqual(changed, want) {
+		t.Errorf("changed = %v, want %v", changed, want)
+	}
+}
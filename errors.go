@@ -0,0 +1,126 @@
+package mapsmith
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ErrRequiredMissing is the FieldError cause for a required key absent from
+// the source.
+var ErrRequiredMissing = errors.New("required field missing")
+
+// ErrUnknownKey is the FieldError cause for a source key that matches no
+// field when the destination has no catch-all, under WithDisallowUnknownKeys.
+var ErrUnknownKey = errors.New("unknown key")
+
+// ErrDuplicateKey is the FieldError cause for a key repeated in the pairs
+// passed to FromPairs under WithRejectDuplicateKeys.
+var ErrDuplicateKey = errors.New("duplicate key")
+
+// ErrUnexportedField is the FieldError cause for a key mapped to a field
+// that cannot be set because it is unexported.
+var ErrUnexportedField = errors.New("cannot set unexported field")
+
+// ErrNonFiniteFloat is the FieldError cause for a NaN or infinite float
+// encoded under WithNonFiniteFloats(NonFiniteError).
+var ErrNonFiniteFloat = errors.New("non-finite float")
+
+// KindError is the FieldError cause for a value whose type can't be stored
+// in the destination field.
+type KindError struct {
+	Expected reflect.Type
+	Got      reflect.Type
+}
+
+func (e *KindError) Error() string {
+	if e.Expected.Kind().String() == e.Expected.String() && e.Got.Kind().String() == e.Got.String() {
+		return fmt.Sprintf("expected %s, got %s", e.Expected.Kind(), e.Got.Kind())
+	}
+
+	return fmt.Sprintf("expected %s (%s), got %s (%s)", e.Expected.Kind(), e.Expected, e.Got.Kind(), e.Got)
+}
+
+// FieldError is a decode failure for a single key. Key is the dotted path of
+// the field within the source map, or empty for the destination itself.
+type FieldError struct {
+	Key string
+	Err error
+}
+
+func (e *FieldError) Error() string {
+	if e.Err == ErrRequiredMissing && e.Key != "" {
+		return fmt.Sprintf("mapsmith: required field %q missing", e.Key)
+	}
+
+	if e.Key == "" {
+		return fmt.Sprintf("mapsmith: %v", e.Err)
+	}
+
+	return fmt.Sprintf("mapsmith: field %q: %v", e.Key, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeError is returned by the error-returning decode functions and holds
+// every FieldError encountered, sorted by key.
+type DecodeError struct {
+	Errors []*FieldError
+}
+
+func (e *DecodeError) Error() string {
+	if len(e.Errors) == 1 {
+		return e.Errors[0].Error()
+	}
+
+	msgs := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		msgs[i] = fe.Error()
+	}
+
+	return fmt.Sprintf("mapsmith: %d decode errors: %s", len(e.Errors), strings.Join(msgs, "; "))
+}
+
+func (e *DecodeError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, fe := range e.Errors {
+		errs[i] = fe
+	}
+
+	return errs
+}
+
+func newDecodeError(errs []*FieldError) *DecodeError {
+	sorted := make([]*FieldError, len(errs))
+	copy(sorted, errs)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Key < sorted[j].Key
+	})
+
+	return &DecodeError{Errors: sorted}
+}
+
+// SchemaError is returned by ValidateExact. Unknown lists the source keys no
+// field maps and Missing the required keys absent from the source, both
+// sorted.
+type SchemaError struct {
+	Unknown []string
+	Missing []string
+}
+
+func (e *SchemaError) Error() string {
+	var parts []string
+	if len(e.Unknown) > 0 {
+		parts = append(parts, fmt.Sprintf("unknown keys %s", strings.Join(e.Unknown, ", ")))
+	}
+
+	if len(e.Missing) > 0 {
+		parts = append(parts, fmt.Sprintf("missing required keys %s", strings.Join(e.Missing, ", ")))
+	}
+
+	return "mapsmith: " + strings.Join(parts, "; ")
+}
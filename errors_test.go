@@ -0,0 +1,128 @@
+package mapsmith
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type pointerInline struct {
+	Base *ExportedBase `map:",inline"`
+	Age  int           `map:"age"`
+}
+
+func TestFromMapEReportsFieldErrors(t *testing.T) {
+	var dest basic
+	err := FromMapE(map[string]interface{}{"name": 5, "count": 1}, &dest)
+	var de *DecodeError
+	if !errors.As(err, &de) || len(de.Errors) != 1 || de.Errors[0].Key != "name" {
+		t.Fatalf("err = %v, want one error for key name", err)
+	}
+
+	var ke *KindError
+	if !errors.As(de.Errors[0], &ke) || ke.Expected.Kind().String() != "string" || ke.Got.Kind().String() != "int" {
+		t.Fatalf("cause = %v, want a KindError from int to string", de.Errors[0].Err)
+	}
+
+	if dest.Count != 1 {
+		t.Fatalf("valid key not decoded: %+v", dest)
+	}
+}
+
+func TestFromMapERejectsBadDest(t *testing.T) {
+	n := 1
+	for _, dest := range []interface{}{nil, basic{}, (*basic)(nil), &n, (*map[string]int)(nil)} {
+		if err := FromMapE(map[string]interface{}{"name": "a"}, dest); err == nil {
+			t.Errorf("FromMapE(%T) accepted", dest)
+		}
+	}
+}
+
+func TestFromMapEUnknownKeys(t *testing.T) {
+	m := map[string]interface{}{"name": "a", "extra": 1}
+	if err := FromMapE(m, &basic{}); err != nil {
+		t.Fatalf("unknown key reported by default: %v", err)
+	}
+
+	err := FromMapE(m, &basic{}, WithDisallowUnknownKeys())
+	if !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("err = %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestFromMapEInlinePointer(t *testing.T) {
+	// A struct passed by value can't have its nil inline pointer filled in.
+	err := FromMapE(map[string]interface{}{"id": 1}, pointerInline{})
+	if err == nil {
+		t.Fatal("struct passed by value accepted")
+	}
+
+	var dest pointerInline
+	if err := FromMapE(map[string]interface{}{"id": 1, "age": 2}, &dest); err != nil {
+		t.Fatal(err)
+	}
+
+	if dest.Base == nil || dest.Base.ID != 1 || dest.Age != 2 {
+		t.Fatalf("got %+v", dest)
+	}
+}
+
+func TestFailFast(t *testing.T) {
+	m := map[string]interface{}{"name": 1, "count": "x"}
+	err := FromMapE(m, &basic{})
+	var de *DecodeError
+	if !errors.As(err, &de) || len(de.Errors) != 2 {
+		t.Fatalf("err = %v, want both errors collected", err)
+	}
+
+	err = FromMapE(m, &basic{}, WithFailFast(true))
+	if !errors.As(err, &de) || len(de.Errors) != 1 {
+		t.Fatalf("err = %v, want one error under WithFailFast", err)
+	}
+}
+
+func TestRequiredNestedStruct(t *testing.T) {
+	type service struct {
+		Name string   `map:"name"`
+		DB   dbConfig `map:"db,required"`
+	}
+
+	err := FromMapE(map[string]interface{}{"name": "s"}, &service{})
+	var de *DecodeError
+	if !errors.As(err, &de) || len(de.Errors) != 1 || de.Errors[0].Key != "db" || !errors.Is(err, ErrRequiredMissing) {
+		t.Fatalf("missing entirely: err = %v", err)
+	}
+
+	err = FromMapE(map[string]interface{}{"db": "localhost"}, &service{})
+	if !errors.As(err, &de) || len(de.Errors) != 1 || de.Errors[0].Key != "db" || errors.Is(err, ErrRequiredMissing) {
+		t.Fatalf("wrong type: err = %v", err)
+	}
+
+	if want := `mapsmith: field "db": expected a map for mapsmith.dbConfig, got string`; err.Error() != want {
+		t.Fatalf("wrong type: err = %q, want %q", err, want)
+	}
+}
+
+func TestRequiredMissingReportsEveryKey(t *testing.T) {
+	type request struct {
+		ID    int    `map:"id,required"`
+		Owner string `map:"owner,required"`
+		Note  string `map:"note,required"`
+	}
+
+	err := FromMapE(map[string]interface{}{"note": "n"}, &request{})
+	var de *DecodeError
+	if !errors.As(err, &de) || len(de.Errors) != 2 {
+		t.Fatalf("err = %v, want two missing keys", err)
+	}
+
+	for _, fe := range de.Errors {
+		if !errors.Is(fe, ErrRequiredMissing) || (fe.Key != "id" && fe.Key != "owner") {
+			t.Errorf("field error = %v", fe)
+		}
+	}
+
+	if !strings.Contains(err.Error(), `"id"`) {
+		t.Errorf("message %q doesn't name the key", err)
+	}
+}
@@ -0,0 +1,78 @@
+package mapsmith
+
+import (
+	"reflect"
+)
+
+// FilterByStruct returns a copy of m holding only the keys v's type maps, at
+// every nesting level. Keys that would land in a catch-all are kept as is.
+// When v is nil or not a struct, m is returned unchanged.
+func FilterByStruct(m map[string]interface{}, v interface{}, opts ...Option) map[string]interface{} {
+	return TaggedFilterByStruct(m, v, DefaultTag, DefaultTag, opts...)
+}
+
+func TaggedFilterByStruct(m map[string]interface{}, v interface{}, nameTag string, filterTag string, opts ...Option) map[string]interface{} {
+	return filterByType(m, reflect.TypeOf(v), nameTag, filterTag, newOptions(opts))
+}
+
+func filterByType(m map[string]interface{}, t reflect.Type, nameTag string, filterTag string, o *options) map[string]interface{} {
+	if t == nil || !isStructType(t) {
+		return m
+	}
+
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	filtered := make(map[string]interface{})
+	info, err := getMappings(reflect.New(t).Interface(), nameTag, filterTag, o)
+	if err != nil {
+		return filtered
+	}
+
+	for k, v := range m {
+		f, ok := info.Fields[k]
+		if !ok {
+			if info.Extra != nil {
+				filtered[k] = v
+			}
+
+			continue
+		}
+
+		filtered[k] = filterValue(v, fieldType(f), nameTag, filterTag, o)
+	}
+
+	return filtered
+}
+
+func filterValue(v interface{}, t reflect.Type, nameTag string, filterTag string, o *options) interface{} {
+	if isStructType(t) {
+		if sub, ok := v.(map[string]interface{}); ok {
+			return filterByType(sub, t, nameTag, filterTag, o)
+		}
+
+		return v
+	}
+
+	if (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && isStructType(t.Elem()) {
+		switch items := v.(type) {
+		case []interface{}:
+			filtered := make([]interface{}, len(items))
+			for i, item := range items {
+				filtered[i] = filterValue(item, t.Elem(), nameTag, filterTag, o)
+			}
+
+			return filtered
+		case []map[string]interface{}:
+			filtered := make([]map[string]interface{}, len(items))
+			for i, item := range items {
+				filtered[i] = filterByType(item, t.Elem(), nameTag, filterTag, o)
+			}
+
+			return filtered
+		}
+	}
+
+	return v
+}
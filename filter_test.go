@@ -0,0 +1,75 @@
+package mapsmith
+
+import (
+	"reflect"
+	"testing"
+)
+
+type projection struct {
+	Name  string        `map:"name"`
+	DB    dbConfig      `map:"db"`
+	Items []item        `map:"items"`
+	Meta  *withCatchAll `map:"meta"`
+}
+
+func TestFilterByStruct(t *testing.T) {
+	src := map[string]interface{}{
+		"name":  "app",
+		"drop":  true,
+		"db":    map[string]interface{}{"host": "h", "password": "p"},
+		"items": []interface{}{map[string]interface{}{"id": 1, "x": 2}},
+		"meta":  map[string]interface{}{"name": "m", "any": "kept"},
+	}
+
+	got := FilterByStruct(src, projection{})
+	want := map[string]interface{}{
+		"name":  "app",
+		"db":    map[string]interface{}{"host": "h"},
+		"items": []interface{}{map[string]interface{}{"id": 1}},
+		"meta":  map[string]interface{}{"name": "m", "any": "kept"},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("FilterByStruct = %v, want %v", got, want)
+	}
+
+	if _, ok := src["drop"]; !ok {
+		t.Fatal("source modified")
+	}
+}
+
+func TestFilterByStructNonStruct(t *testing.T) {
+	src := map[string]interface{}{"name": "app", "drop": true}
+	for _, v := range []interface{}{nil, 1, (*int)(nil), map[string]interface{}{}} {
+		if got := FilterByStruct(src, v); !reflect.DeepEqual(got, src) {
+			t.Errorf("FilterByStruct(%T) = %v, want the input", v, got)
+		}
+	}
+}
+
+func TestFilterMapDeep(t *testing.T) {
+	m := map[string]interface{}{
+		"name": "n",
+		"server": map[string]interface{}{
+			"tls":  map[string]interface{}{"cert": "c", "key": "k"},
+			"port": 443,
+		},
+		"db":  map[string]interface{}{"host": "h", "auth": map[string]interface{}{"user": "u"}},
+		"log": map[string]interface{}{"level": "info"},
+	}
+
+	got := FilterMapDeep(m, []string{"name", "server.tls.cert", "db.*", "log.missing"})
+	want := map[string]interface{}{
+		"name":   "n",
+		"server": map[string]interface{}{"tls": map[string]interface{}{"cert": "c"}},
+		"db":     map[string]interface{}{"host": "h", "auth": map[string]interface{}{"user": "u"}},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("FilterMapDeep = %v, want %v", got, want)
+	}
+
+	if got, want := FilterMapDeep(m, []string{"name", "log"}), FilterMap(m, []string{"name", "log"}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("plain keys: FilterMapDeep = %v, FilterMap = %v", got, want)
+	}
+}
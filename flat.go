@@ -0,0 +1,223 @@
+package mapsmith
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ToFlatMap encodes v into a single-level map whose keys are the paths to
+// each leaf, e.g. "a.b.c" for nested structs and "a.0" for slice elements.
+// Empty maps and slices are kept as leaf values so they survive a round trip.
+func ToFlatMap(v interface{}, opts ...Option) map[string]interface{} {
+	o := newOptions(opts)
+	flat := make(map[string]interface{})
+	m, err := toMap(v, DefaultTag, DefaultTag, o)
+	if err != nil {
+		return flat
+	}
+
+	flattenInto(flat, "", m, o, true)
+	return flat
+}
+
+// flattenInto adds the leaves of v to flat under prefix. Slice elements get
+// their own keys only when slices is set; otherwise slices are leaves.
+func flattenInto(flat map[string]interface{}, prefix string, v interface{}, o *options, slices bool) {
+	if m, ok := v.(map[string]interface{}); ok && (len(m) > 0 || prefix == "") {
+		for k, item := range m {
+			key := k
+			if prefix != "" {
+				key = prefix + o.flatSep + k
+			}
+
+			flattenInto(flat, key, item, o, slices)
+		}
+
+		return
+	}
+
+	rv := reflect.ValueOf(v)
+	if slices && (rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array) && rv.Len() > 0 && !isBytesType(rv.Type()) && prefix != "" {
+		pre, suf := flatIndexAffixes(o)
+		for i := 0; i < rv.Len(); i++ {
+			flattenInto(flat, prefix+pre+strconv.Itoa(i)+suf, rv.Index(i).Interface(), o, slices)
+		}
+
+		return
+	}
+
+	flat[prefix] = v
+}
+
+func flatIndexAffixes(o *options) (string, string) {
+	if strings.Count(o.flatIndex, "%d") == 1 {
+		parts := strings.SplitN(o.flatIndex, "%d", 2)
+		return parts[0], parts[1]
+	}
+
+	return o.flatSep, ""
+}
+
+// FromFlatMap rebuilds the nested form of a map produced by ToFlatMap and
+// decodes it into dest. Path segments that look like indices always become
+// slice elements. A key that is both a leaf and the parent of other keys is
+// an error.
+func FromFlatMap(flat map[string]interface{}, dest interface{}, opts ...Option) error {
+	m, err := unflattenMap(flat, newOptions(opts), true)
+	if err != nil {
+		return err
+	}
+
+	return FromMapE(m, dest, opts...)
+}
+
+type flatToken struct {
+	name    string
+	index   int
+	isIndex bool
+}
+
+// unflattenMap nests the keys of flat back into maps. Path segments that look
+// like indices become slice elements only when slices is set.
+func unflattenMap(flat map[string]interface{}, o *options, slices bool) (map[string]interface{}, error) {
+	var root interface{} = make(map[string]interface{})
+	for _, key := range SortedKeys(flat) {
+		var tokens []flatToken
+		if slices {
+			tokens = splitFlatKey(key, o)
+		} else {
+			for _, part := range strings.Split(key, o.flatSep) {
+				tokens = append(tokens, flatToken{name: part})
+			}
+		}
+
+		for _, t := range tokens {
+			if t.isIndex && t.index > len(flat) {
+				return nil, fmt.Errorf("mapsmith: flat key %q: index %d out of range", key, t.index)
+			}
+		}
+
+		next, err := insertFlat(root, tokens, flat[key])
+		if err != nil {
+			return nil, fmt.Errorf("mapsmith: flat key %q: %w", key, err)
+		}
+
+		root = next
+	}
+
+	return root.(map[string]interface{}), nil
+}
+
+func splitFlatKey(key string, o *options) []flatToken {
+	pre, suf := flatIndexAffixes(o)
+	var tokens []flatToken
+	rest := key
+	for first := true; first || rest != ""; first = false {
+		if !first && strings.HasPrefix(rest, pre) {
+			digits := rest[len(pre):]
+			n := 0
+			for n < len(digits) && digits[n] >= '0' && digits[n] <= '9' {
+				n++
+			}
+
+			after := digits[n:]
+			if n > 0 && strings.HasPrefix(after, suf) {
+				after = after[len(suf):]
+				if after == "" || strings.HasPrefix(after, o.flatSep) || strings.HasPrefix(after, pre) {
+					index, _ := strconv.Atoi(digits[:n])
+					tokens = append(tokens, flatToken{index: index, isIndex: true})
+					rest = after
+					continue
+				}
+			}
+		}
+
+		if !first && strings.HasPrefix(rest, o.flatSep) {
+			rest = rest[len(o.flatSep):]
+		}
+
+		end := len(rest)
+		if i := strings.Index(rest, o.flatSep); i >= 0 && o.flatSep != "" {
+			end = i
+		}
+
+		if i := strings.Index(rest, pre); i > 0 && i < end && pre != "" {
+			end = i
+		}
+
+		tokens = append(tokens, flatToken{name: rest[:end]})
+		rest = rest[end:]
+	}
+
+	return tokens
+}
+
+func insertFlat(node interface{}, tokens []flatToken, value interface{}) (interface{}, error) {
+	if len(tokens) < 1 {
+		if node != nil {
+			return nil, fmt.Errorf("value conflicts with nested keys")
+		}
+
+		return value, nil
+	}
+
+	t := tokens[0]
+	if t.isIndex {
+		list, ok := node.([]interface{})
+		if node != nil && !ok {
+			return nil, fmt.Errorf("index applied to non-list value")
+		}
+
+		for len(list) <= t.index {
+			list = append(list, nil)
+		}
+
+		child, err := insertFlat(list[t.index], tokens[1:], value)
+		if err != nil {
+			return nil, err
+		}
+
+		list[t.index] = child
+		return list, nil
+	}
+
+	m, ok := node.(map[string]interface{})
+	if node == nil {
+		m = make(map[string]interface{})
+	} else if !ok {
+		return nil, fmt.Errorf("key %q nested under a non-map value", t.name)
+	}
+
+	child, err := insertFlat(m[t.name], tokens[1:], value)
+	if err != nil {
+		return nil, err
+	}
+
+	m[t.name] = child
+	return m, nil
+}
+
+// FlattenMap turns nested maps within m into a single-level map keyed by
+// their paths joined with sep, e.g. "address.city". Other values, including
+// slices and empty maps, are kept as leaves. The default separator is ".".
+func FlattenMap(m map[string]interface{}, sep string) map[string]interface{} {
+	if sep == "" {
+		sep = "."
+	}
+
+	flat := make(map[string]interface{})
+	flattenInto(flat, "", m, newOptions([]Option{WithFlatSeparator(sep)}), false)
+	return flat
+}
+
+// UnflattenMap is the inverse of FlattenMap. A key that is both a leaf and
+// the parent of other keys, such as "a" alongside "a.b", is an error.
+func UnflattenMap(flat map[string]interface{}, sep string) (map[string]interface{}, error) {
+	if sep == "" {
+		sep = "."
+	}
+
+	return unflattenMap(flat, newOptions([]Option{WithFlatSeparator(sep)}), false)
+}
@@ -0,0 +1,102 @@
+package mapsmith
+
+import (
+	"reflect"
+	"testing"
+)
+
+type group struct {
+	Name    string   `map:"name"`
+	Members []item   `map:"members"`
+	Tags    []string `map:"tags"`
+}
+
+type org struct {
+	Title  string  `map:"title"`
+	Groups []group `map:"groups"`
+	Empty  []item  `map:"empty"`
+}
+
+func TestFlatMapRoundTrip(t *testing.T) {
+	v := org{
+		Title: "o",
+		Groups: []group{
+			{Name: "a", Members: []item{{1}, {2}}, Tags: []string{"x"}},
+			{Name: "b", Tags: []string{}},
+		},
+		Empty: []item{},
+	}
+
+	tests := []struct {
+		name string
+		opts []Option
+		key  string
+	}{
+		{"default", nil, "groups.0.members.1.id"},
+		{"separator", []Option{WithFlatSeparator("/")}, "groups/0/members/1/id"},
+		{"index format", []Option{WithFlatIndexFormat("[%d]")}, "groups[0].members[1].id"},
+		{"both", []Option{WithFlatSeparator("_"), WithFlatIndexFormat("[%d]")}, "groups[0]_members[1]_id"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flat := ToFlatMap(v, tt.opts...)
+			if flat[tt.key] != 2 {
+				t.Fatalf("flat[%q] = %v in %v", tt.key, flat[tt.key], flat)
+			}
+
+			var got org
+			if err := FromFlatMap(flat, &got, tt.opts...); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, v) {
+				t.Fatalf("round trip = %+v, want %+v", got, v)
+			}
+		})
+	}
+
+	if err := FromFlatMap(map[string]interface{}{"title": "t", "title.x": 1}, &org{}); err == nil {
+		t.Fatal("leaf and parent key accepted")
+	}
+}
+
+func TestFlattenMap(t *testing.T) {
+	m := map[string]interface{}{
+		"name":    "n",
+		"address": map[string]interface{}{"city": "c", "geo": map[string]interface{}{"lat": 1.5}},
+		"tags":    []interface{}{"a"},
+		"empty":   map[string]interface{}{},
+	}
+
+	flat := FlattenMap(m, "")
+	want := map[string]interface{}{
+		"name":            "n",
+		"address.city":    "c",
+		"address.geo.lat": 1.5,
+		"tags":            []interface{}{"a"},
+		"empty":           map[string]interface{}{},
+	}
+
+	if !reflect.DeepEqual(flat, want) {
+		t.Fatalf("FlattenMap = %v, want %v", flat, want)
+	}
+
+	back, err := UnflattenMap(FlattenMap(m, "/"), "/")
+	if err != nil || !reflect.DeepEqual(back, m) {
+		t.Fatalf("UnflattenMap = %v, %v, want %v", back, err, m)
+	}
+
+	if _, err := UnflattenMap(map[string]interface{}{"a": 1, "a.b": 2}, "."); err == nil {
+		t.Fatal("scalar and parent key accepted")
+	}
+
+	back, err = UnflattenMap(map[string]interface{}{"tags.0": "a"}, ".")
+	if want := map[string]interface{}{"tags": map[string]interface{}{"0": "a"}}; err != nil || !reflect.DeepEqual(back, want) {
+		t.Fatalf("UnflattenMap = %v, %v, want %v", back, err, want)
+	}
+
+	if flat := FlattenMap(map[string]interface{}{}, "."); len(flat) != 0 {
+		t.Fatalf("FlattenMap of an empty map = %v", flat)
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/danielkrainas/mapsmith
+
+go 1.20
@@ -0,0 +1,114 @@
+package mapsmith
+
+import (
+	"reflect"
+	"sync"
+)
+
+type mappedField struct {
+	index int
+	name  string
+	flags stringSet
+	// embedded marks an untagged embedded struct promoted as if inline.
+	embedded bool
+}
+
+type planKey struct {
+	t         reflect.Type
+	nameTag   string
+	filterTag string
+
+	strictTags      bool
+	skipUnsupported bool
+	strictTypes     bool
+	taggedOnly      bool
+}
+
+// planCache holds the field plan of every struct type seen. A nil cache
+// plans every call afresh.
+type planCache struct {
+	plans sync.Map
+}
+
+// defaultPlans is shared by every call made without a Mapper. Options whose
+// effect on a plan can't be part of its key, i.e. WithKeyTransform, bypass
+// it.
+var defaultPlans = &planCache{}
+
+func (o *options) planCache() *planCache {
+	if o.plans != nil {
+		return o.plans
+	}
+
+	if o.keyTransform != nil {
+		return nil
+	}
+
+	return defaultPlans
+}
+
+func (c *planCache) lookup(t reflect.Type, fields []Field, nameTag string, filterTag string, o *options) ([]mappedField, error) {
+	if c == nil || t == nil {
+		return planFields(fields, nameTag, filterTag, o)
+	}
+
+	key := planKey{
+		t:               t,
+		nameTag:         nameTag,
+		filterTag:       filterTag,
+		strictTags:      o.strictTags,
+		skipUnsupported: o.skipUnsupported,
+		strictTypes:     o.strictTypes,
+		taggedOnly:      o.taggedOnly,
+	}
+
+	if plan, ok := c.plans.Load(key); ok {
+		return plan.([]mappedField), nil
+	}
+
+	plan, err := planFields(fields, nameTag, filterTag, o)
+	if err != nil {
+		return nil, err
+	}
+
+	c.plans.Store(key, plan)
+	return plan, nil
+}
+
+// Mapper encodes and decodes with a fixed set of tags and options, caching
+// the field layout of each struct type it meets instead of re-reading tags
+// on every call. A Mapper is safe for concurrent use.
+type Mapper struct {
+	nameTag   string
+	filterTag string
+	o         *options
+}
+
+// NewMapper returns a Mapper for sample's type and any types reached from
+// it, planning sample's layout up front.
+func NewMapper(sample interface{}, nameTag string, filterTag string, opts ...Option) (*Mapper, error) {
+	o := newOptions(opts)
+	o.plans = &planCache{}
+	if filterTag == "" {
+		filterTag = nameTag
+	}
+
+	mp := &Mapper{nameTag: nameTag, filterTag: filterTag, o: o}
+	if _, err := getMappings(sample, nameTag, filterTag, o); err != nil {
+		return nil, err
+	}
+
+	return mp, nil
+}
+
+// ToMap is like the package-level ToMap, using the Mapper's tags, options
+// and plan cache.
+func (mp *Mapper) ToMap(v interface{}) (map[string]interface{}, error) {
+	return encodeRoot(v, mp.nameTag, mp.filterTag, mp.o)
+}
+
+// FromMap is like the package-level FromMap, using the Mapper's tags,
+// options and plan cache.
+func (mp *Mapper) FromMap(m map[string]interface{}, dest interface{}) error {
+	return newDecoder(mp.nameTag, mp.filterTag, mp.o).decodeRoot(m, dest)
+}
@@ -0,0 +1,91 @@
+package mapsmith
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestMapper(t *testing.T) {
+	mp, err := NewMapper(itemList{}, DefaultTag, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := mp.o.plans.plans.Load(planKey{t: reflect.TypeOf(itemList{}), nameTag: DefaultTag, filterTag: DefaultTag}); !ok {
+		t.Fatal("NewMapper didn't plan the sample's type")
+	}
+
+	v := itemList{Items: []item{{1}, {2}}, Names: []string{"a"}}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m, err := mp.ToMap(v)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			var got itemList
+			if err := mp.FromMap(m, &got); err != nil || !reflect.DeepEqual(got, v) {
+				t.Errorf("round trip = %+v, %v", got, err)
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+func TestMapperKeyTransform(t *testing.T) {
+	type account struct {
+		UserID int `map:",omitempty"`
+	}
+
+	mp, err := NewMapper(account{}, DefaultTag, DefaultTag, WithKeyTransform(SnakeCase))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := mp.ToMap(account{1})
+	if err != nil || !reflect.DeepEqual(m, map[string]interface{}{"user_id": 1}) {
+		t.Fatalf("ToMap = %v, %v", m, err)
+	}
+
+	if m := ToMap(account{1}); !reflect.DeepEqual(m, map[string]interface{}{"UserID": 1}) {
+		t.Fatalf("Mapper plan leaked into the shared cache: %v", m)
+	}
+}
+
+func TestDefaultPlanCache(t *testing.T) {
+	type cachedOnce struct {
+		A int `map:"a"`
+	}
+
+	key := planKey{t: reflect.TypeOf(cachedOnce{}), nameTag: DefaultTag, filterTag: DefaultTag}
+	defaultPlans.plans.Delete(key)
+
+	ToMap(cachedOnce{1})
+	plan, ok := defaultPlans.plans.Load(key)
+	if !ok {
+		t.Fatal("ToMap didn't cache the plan")
+	}
+
+	var got cachedOnce
+	FromMap(map[string]interface{}{"a": 2}, &got)
+	if again, _ := defaultPlans.plans.Load(key); got.A != 2 || reflect.ValueOf(again).Pointer() != reflect.ValueOf(plan).Pointer() {
+		t.Fatalf("FromMap replanned the type or failed: %+v", got)
+	}
+
+	type transformed struct {
+		B int `map:"b"`
+	}
+
+	transformedKey := planKey{t: reflect.TypeOf(transformed{}), nameTag: DefaultTag, filterTag: DefaultTag}
+	defaultPlans.plans.Delete(transformedKey)
+	ToMap(transformed{}, WithKeyTransform(SnakeCase))
+	if _, ok := defaultPlans.plans.Load(transformedKey); ok {
+		t.Fatal("a WithKeyTransform plan was shared")
+	}
+}
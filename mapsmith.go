@@ -1,9 +1,16 @@
 package mapsmith
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"unicode"
 )
 
 const DefaultTag = "map"
@@ -13,8 +20,35 @@ func isStruct(v interface{}) bool {
 	return vv.Kind() == reflect.Struct || (vv.Kind() == reflect.Ptr && vv.Elem().Kind() == reflect.Struct)
 }
 
+func isStructType(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct || (t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct)
+}
+
+func isUnsupportedKind(k reflect.Kind) bool {
+	return k == reflect.Chan || k == reflect.Func || k == reflect.UnsafePointer
+}
+
+func baseType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Ptr {
+		return t.Elem()
+	}
+
+	return t
+}
+
+func isBytesType(t reflect.Type) bool {
+	return t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8
+}
+
+// newStructAdapter reads the struct v holds or points to. A nil pointer
+// yields an adapter without fields.
 func newStructAdapter(v interface{}) *structAdapter {
-	return &structAdapter{T: reflect.TypeOf(v)}
+	vv := reflect.Indirect(reflect.ValueOf(v))
+	if !vv.IsValid() {
+		return &structAdapter{}
+	}
+
+	return &structAdapter{T: vv.Type(), V: vv}
 }
 
 type structAdapter struct {
@@ -23,6 +57,10 @@ type structAdapter struct {
 }
 
 func (a *structAdapter) Fields() []Field {
+	if !a.V.IsValid() || a.V.Kind() != reflect.Struct {
+		return nil
+	}
+
 	max := a.V.NumField()
 	fields := make([]Field, max)
 	for i := 0; i < max; i++ {
@@ -53,6 +91,18 @@ func (ss stringSet) Contains(key string) bool {
 	return ok
 }
 
+// Param returns the value of a "name=value" entry.
+func (ss stringSet) Param(name string) (string, bool) {
+	prefix := name + "="
+	for key := range ss {
+		if strings.HasPrefix(key, prefix) {
+			return key[len(prefix):], true
+		}
+	}
+
+	return "", false
+}
+
 func (ss stringSet) Keys() []string {
 	keys := make([]string, 0, len(ss))
 	for key := range ss {
@@ -72,6 +122,54 @@ type Field interface {
 	HasTag(name string) bool
 }
 
+// errorSetter is a Field or FieldAdapter whose Set can say why a value wasn't
+// stored. The package's own fields implement it; the exported interfaces
+// keep their original signatures.
+type errorSetter interface {
+	trySet(v interface{}) error
+}
+
+// errorIndexSetter is the MapFieldAdapter counterpart of errorSetter.
+type errorIndexSetter interface {
+	trySetIndex(index string, value interface{}) error
+}
+
+// typedField is a field that knows its declared type.
+type typedField interface {
+	Type() reflect.Type
+}
+
+// setField stores v in f, reporting failures when f can describe them.
+func setField(f interface{ Set(v interface{}) }, v interface{}) error {
+	if s, ok := f.(errorSetter); ok {
+		return s.trySet(v)
+	}
+
+	f.Set(v)
+	return nil
+}
+
+// setIndex stores value under index in a, reporting failures when a can
+// describe them.
+func setIndex(a MapFieldAdapter, index string, value interface{}) error {
+	if s, ok := a.(errorIndexSetter); ok {
+		return s.trySetIndex(index, value)
+	}
+
+	a.SetIndex(index, value)
+	return nil
+}
+
+// fieldType returns f's declared type, falling back to the type of its
+// current value for fields that don't know it.
+func fieldType(f interface{ Value() interface{} }) reflect.Type {
+	if t, ok := f.(typedField); ok {
+		return t.Type()
+	}
+
+	return reflect.TypeOf(f.Value())
+}
+
 type fieldHelper struct {
 	V reflect.Value
 	F reflect.StructField
@@ -94,35 +192,108 @@ func (f *fieldHelper) Kind() reflect.Kind {
 	return f.V.Kind()
 }
 
+func (f *fieldHelper) Type() reflect.Type {
+	return f.F.Type
+}
+
 func (f *fieldHelper) Value() interface{} {
 	return f.V.Interface()
 }
 
 func (f *fieldHelper) IsZero() bool {
-	zero := reflect.Zero(f.F.Type).Interface()
-	current := f.Value()
-	return reflect.DeepEqual(current, zero)
+	return isZeroValue(f.Value(), f.F.Type)
+}
+
+func isZeroValue(v interface{}, t reflect.Type) bool {
+	return reflect.DeepEqual(v, reflect.Zero(t).Interface())
+}
+
+// isEmptyValue is the omitempty test: like isZeroValue, except that empty
+// slices, maps and strings count as empty even when non-nil.
+func isEmptyValue(v interface{}, t reflect.Type) bool {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return true
+	case reflect.Slice, reflect.Map, reflect.String:
+		return rv.Len() == 0
+	case reflect.Ptr, reflect.Interface, reflect.Func, reflect.Chan:
+		return rv.IsNil()
+	}
+
+	return isZeroValue(v, t)
 }
 
 func (f *fieldHelper) Set(v interface{}) {
+	_ = f.trySet(v)
+}
+
+// trySet stores v in the field. A nil v zeroes fields that can hold nil and
+// leaves any other field untouched.
+func (f *fieldHelper) trySet(v interface{}) error {
 	if !f.IsExported() {
-		// TODO: return error
-		return
+		return fmt.Errorf("%w %s", ErrUnexportedField, f.F.Name)
+	}
+
+	if !f.V.CanSet() {
+		return fmt.Errorf("field %s is not addressable; decode into a pointer", f.F.Name)
 	}
 
 	next := reflect.ValueOf(v)
-	if next.Kind() != f.V.Kind() {
-		// TODO: error
-		return
+	if !next.IsValid() {
+		switch f.V.Kind() {
+		case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+			f.V.Set(reflect.Zero(f.F.Type))
+		}
+
+		return nil
+	}
+
+	// Anything assignable goes straight in, including any value into an
+	// interface field it satisfies. Otherwise numbers convert between kinds
+	// and other values only between types of the same kind.
+	switch {
+	case next.Type().AssignableTo(f.F.Type):
+	case isNumberKind(next.Kind()) && isNumberKind(f.V.Kind()):
+		converted, err := convertNumber(next, f.F.Type)
+		if err != nil {
+			return err
+		}
+
+		next = converted
+	case next.Kind() == f.V.Kind() && next.Type().ConvertibleTo(f.F.Type):
+		next = next.Convert(f.F.Type)
+	default:
+		return &KindError{Expected: f.F.Type, Got: next.Type()}
 	}
 
 	f.V.Set(next)
+	return nil
+}
+
+// embedsInterface reports whether f is an embedded interface field, such as
+// an embedded error.
+func embedsInterface(f interface{}) bool {
+	switch f := f.(type) {
+	case *fieldHelper:
+		return f.F.Anonymous && f.F.Type.Kind() == reflect.Interface
+	case *initializerAdapter:
+		return embedsInterface(f.FieldAdapter)
+	}
+
+	return false
 }
 
 func (f *fieldHelper) Name() string {
 	return f.F.Name
 }
 
+func (f *fieldHelper) reset() {
+	if f.IsExported() && f.V.CanSet() {
+		f.V.Set(reflect.Zero(f.F.Type))
+	}
+}
+
 type FieldAdapter interface {
 	Set(v interface{})
 	Value() interface{}
@@ -135,16 +306,89 @@ type MapFieldAdapter interface {
 	Keys() []string
 }
 
+// mapFieldAdapter exposes a catch-all map. Like the rest of a decode it
+// doesn't lock, so it must not be shared between goroutines (see FromMapE).
 type mapFieldAdapter struct {
 	Value reflect.Value
+	deref bool
+	// stringify exposes non-string keys by their fmt.Sprint form.
+	stringify bool
+}
+
+// key returns index as a key of the map, parsing it for the map's key kind
+// when keys are stringified.
+func (a *mapFieldAdapter) key(index string) (reflect.Value, error) {
+	keyType := reflect.Indirect(a.Value).Type().Key()
+	if keyType.Kind() == reflect.String {
+		return reflect.ValueOf(index).Convert(keyType), nil
+	}
+
+	if !a.stringify {
+		return reflect.Value{}, fmt.Errorf("cannot use string key %q in map with %s keys", index, keyType)
+	}
+
+	key, err := parseString(index, keyType)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	kv := reflect.ValueOf(key)
+	if kv.Type() != keyType {
+		return reflect.Value{}, fmt.Errorf("unsupported map key type %s", keyType)
+	}
+
+	return kv, nil
 }
 
 func (a *mapFieldAdapter) SetIndex(index string, value interface{}) {
-	a.Value.SetMapIndex(reflect.ValueOf(index), reflect.ValueOf(value))
+	_ = a.trySetIndex(index, value)
+}
+
+// trySetIndex stores value under index, returning an error when the key or
+// value doesn't fit the map.
+func (a *mapFieldAdapter) trySetIndex(index string, value interface{}) error {
+	m := reflect.Indirect(a.Value)
+	elemType := m.Type().Elem()
+	next := reflect.ValueOf(value)
+	if a.deref {
+		for next.Kind() == reflect.Ptr && next.Type() != elemType {
+			if next.IsNil() {
+				next = reflect.Value{}
+				break
+			}
+
+			next = next.Elem()
+		}
+	}
+
+	if !next.IsValid() {
+		next = reflect.Zero(elemType)
+	}
+
+	if !next.Type().AssignableTo(elemType) {
+		return &KindError{Expected: elemType, Got: next.Type()}
+	}
+
+	key, err := a.key(index)
+	if err != nil {
+		return err
+	}
+
+	m.SetMapIndex(key, next)
+	return nil
 }
 
 func (a *mapFieldAdapter) Index(index string) interface{} {
-	value := a.Value.MapIndex(reflect.ValueOf(index))
+	key, err := a.key(index)
+	if err != nil {
+		return nil
+	}
+
+	value := reflect.Indirect(a.Value).MapIndex(key)
+	if !value.IsValid() {
+		return nil
+	}
+
 	return value.Interface()
 }
 
@@ -158,9 +402,10 @@ func (a *mapFieldAdapter) Keys() []string {
 
 	keys := make([]string, 0)
 	for _, k := range valueKeys {
-		ks, ok := k.Interface().(string)
-		if ok {
-			keys = append(keys, ks)
+		if k.Kind() == reflect.String {
+			keys = append(keys, k.String())
+		} else if a.stringify {
+			keys = append(keys, fmt.Sprint(k.Interface()))
 		}
 	}
 
@@ -171,12 +416,16 @@ type fieldInitializer struct {
 	init     sync.Once
 	instance interface{}
 	target   Field
+	// err is the result of storing instance in target.
+	err error
 }
 
-func (fi *fieldInitializer) ensureInit() {
+func (fi *fieldInitializer) ensureInit() error {
 	fi.init.Do(func() {
-		fi.target.Set(fi.instance)
+		fi.err = setField(fi.target, fi.instance)
 	})
+
+	return fi.err
 }
 
 type initializerAdapter struct {
@@ -185,8 +434,19 @@ type initializerAdapter struct {
 }
 
 func (a *initializerAdapter) Set(v interface{}) {
-	a.initializer.ensureInit()
-	a.FieldAdapter.Set(v)
+	_ = a.trySet(v)
+}
+
+func (a *initializerAdapter) trySet(v interface{}) error {
+	if err := a.initializer.ensureInit(); err != nil {
+		return err
+	}
+
+	return setField(a.FieldAdapter, v)
+}
+
+func (a *initializerAdapter) Type() reflect.Type {
+	return fieldType(a.FieldAdapter)
 }
 
 type mapInitializerAdapter struct {
@@ -195,12 +455,21 @@ type mapInitializerAdapter struct {
 }
 
 func (a *mapInitializerAdapter) SetIndex(index string, value interface{}) {
-	a.initializer.ensureInit()
-	a.MapFieldAdapter.SetIndex(index, value)
+	_ = a.trySetIndex(index, value)
+}
+
+func (a *mapInitializerAdapter) trySetIndex(index string, value interface{}) error {
+	if err := a.initializer.ensureInit(); err != nil {
+		return err
+	}
+
+	return setIndex(a.MapFieldAdapter, index, value)
 }
 
-func parseNameAndFlags(field Field, tagName string) (string, stringSet) {
-	tagValue := field.Tag("map")
+var knownFlags = newStringSet("omitempty", "inline", "bytestring", "discriminator", "scope=", "unix", "unixmilli", "requiredWith=", "default=", "default-if-zero", "keep", "required", "split=", "trim", "min=", "max=", "minlen=", "maxlen=", "group=", "unwrap=", "whole", "mapkey", "json", "secret", "char")
+
+func parseNameAndFlags(field Field, tagName string, strict bool) (string, stringSet, error) {
+	tagValue := field.Tag(tagName)
 	flags := strings.Split(tagValue, ",")
 	name := ""
 	if len(flags) > 0 {
@@ -212,24 +481,42 @@ func parseNameAndFlags(field Field, tagName string) (string, stringSet) {
 		name = field.Name()
 	}
 
-	return name, newStringSet(flags...)
-}
+	// "split=," splits into "split=" and "", so glue the comma back on.
+	for i := 0; i < len(flags)-1; i++ {
+		if flags[i] == "split=" && flags[i+1] == "" {
+			flags[i] = "split=,"
+			flags = append(flags[:i+1], flags[i+2:]...)
+		}
+	}
 
-func parseField(field Field, name string, nameTag string, filterTag string, flags stringSet) (map[string]FieldAdapter, MapFieldAdapter) {
-	var defaultField MapFieldAdapter
-	m := make(map[string]FieldAdapter)
-	if len(flags) < 1 {
-		m[name] = field
-		return m, defaultField
+	if strict {
+		for _, flag := range flags {
+			if flag == "" {
+				return "", nil, fmt.Errorf("mapsmith: field %s: empty flag in tag %q", field.Name(), tagValue)
+			}
+
+			key := flag
+			if i := strings.Index(flag, "="); i >= 0 {
+				key = flag[:i+1]
+			}
+
+			if !knownFlags.Contains(key) {
+				return "", nil, fmt.Errorf("mapsmith: field %s: unrecognized flag %q in tag %q", field.Name(), flag, tagValue)
+			}
+		}
 	}
 
-	if flags.Contains("omitempty") && field.IsZero() {
-		return m, defaultField
+	return name, newStringSet(flags...), nil
+}
+
+func parseField(mi *Info, field Field, name string, nameTag string, filterTag string, flags stringSet, o *options) error {
+	if len(flags) < 1 {
+		return mi.add(name, field, flags, "", o)
 	}
 
 	if flags.Contains("inline") {
 		if field.Kind() != reflect.Ptr && field.Kind() != reflect.Struct && field.Kind() != reflect.Map {
-			return m, defaultField
+			return nil
 		}
 
 		isZero := field.IsZero()
@@ -237,7 +524,12 @@ func parseField(field Field, name string, nameTag string, filterTag string, flag
 		innerValue := field.Value()
 		fieldType := reflect.TypeOf(innerValue)
 		instance := reflect.ValueOf(innerValue)
-		if isZero {
+		// A struct value is bound to the field itself when it can be, so that
+		// decoding writes into it rather than into a copy.
+		if fh, ok := field.(*fieldHelper); ok && kind == reflect.Struct && fh.V.CanAddr() {
+			instance = fh.V.Addr()
+			isZero = false
+		} else if isZero {
 			if kind == reflect.Ptr {
 				instance = reflect.New(fieldType.Elem())
 			} else if kind == reflect.Map {
@@ -252,7 +544,7 @@ func parseField(field Field, name string, nameTag string, filterTag string, flag
 				instance = reflect.Indirect(instance)
 			}
 
-			if defaultField != nil {
+			if mi.Extra != nil {
 				// TODO: warn of overshadowing inner catch-all's
 			}
 
@@ -260,161 +552,2173 @@ func parseField(field Field, name string, nameTag string, filterTag string, flag
 				// TODO: warn we can't use this type of map as catch-all
 			}
 
-			defaultField = &mapInitializerAdapter{
-				MapFieldAdapter: &mapFieldAdapter{Value: instance},
+			mi.Extra = &mapInitializerAdapter{
+				MapFieldAdapter: &mapFieldAdapter{Value: instance, deref: o.derefExtras, stringify: o.stringifyKeys},
 				initializer: &fieldInitializer{
 					instance: instance.Interface(),
 					target:   field,
 				},
 			}
 		} else {
-			innerInfo := GetMappings(instance.Interface(), nameTag, filterTag)
-			for ink, inf := range innerInfo.Fields {
-				// todo: warn of duplicate
+			innerInfo, err := getMappings(instance.Interface(), nameTag, filterTag, o)
+			if err != nil {
+				return err
+			}
+
+			for _, ink := range innerInfo.orderedKeys() {
+				inf := innerInfo.Fields[ink]
 				if isZero {
-					m[ink] = &initializerAdapter{
+					inf = &initializerAdapter{
 						FieldAdapter: inf,
 						initializer: &fieldInitializer{
 							instance: instance.Interface(),
 							target:   field,
 						},
 					}
-				} else {
-					m[ink] = inf
+				}
+
+				if err := mi.add(ink, inf, innerInfo.flags[ink], name, o); err != nil {
+					return err
 				}
 			}
 		}
 	} else {
-		m[name] = field
+		return mi.add(name, field, flags, "", o)
 	}
 
-	return m, defaultField
+	return nil
 }
 
 type Info struct {
 	Fields map[string]FieldAdapter
 	Extra  MapFieldAdapter
+
+	flags map[string]stringSet
+	// promoted records the inline field each promoted key came from.
+	promoted map[string]string
+	// embedded holds the names of untagged embedded structs being promoted.
+	embedded map[string]bool
+	// order lists keys in the order their fields are declared.
+	order []string
+}
+
+// orderedKeys returns the mapped keys in field declaration order.
+func (mi *Info) orderedKeys() []string {
+	keys := make([]string, 0, len(mi.Fields))
+	seen := make(map[string]bool, len(mi.Fields))
+	for _, k := range mi.order {
+		if _, ok := mi.Fields[k]; ok && !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+
+	return keys
+}
+
+func (mi *Info) keys(sorted bool) []string {
+	keys := make([]string, 0, len(mi.Fields))
+	for k := range mi.Fields {
+		keys = append(keys, k)
+	}
+
+	if sorted {
+		sort.Strings(keys)
+	}
+
+	return keys
+}
+
+func (mi *Info) set(key string, field FieldAdapter, flags stringSet, from string) {
+	if _, exists := mi.Fields[key]; !exists {
+		mi.order = append(mi.order, key)
+	}
+
+	mi.Fields[key] = field
+	mi.flags[key] = flags
+	if from != "" {
+		mi.promoted[key] = from
+	} else {
+		delete(mi.promoted, key)
+	}
+}
+
+// add maps key to field, resolving collisions that involve a key promoted
+// from an inline field (from is that field's name) by the configured
+// ConflictStrategy.
+func (mi *Info) add(key string, field FieldAdapter, flags stringSet, from string, o *options) error {
+	_, exists := mi.Fields[key]
+	existingFrom := mi.promoted[key]
+	if !exists || (from == "" && existingFrom == "") {
+		mi.set(key, field, flags, from)
+		return nil
+	}
+
+	// Keys promoted from untagged embedded structs always give way to the
+	// outer struct's own fields.
+	if from == "" && mi.embedded[existingFrom] {
+		mi.set(key, field, flags, from)
+		return nil
+	} else if existingFrom == "" && mi.embedded[from] {
+		return nil
+	}
+
+	switch o.conflicts {
+	case ConflictError:
+		if from == "" {
+			from = existingFrom
+		}
+
+		return fmt.Errorf("mapsmith: key %q promoted from inline field %s collides with another field", key, from)
+	case ConflictFirstWins:
+		return nil
+	case ConflictPrefixInline:
+		if from != "" {
+			mi.set(from+"_"+key, field, flags, from)
+			return nil
+		}
+
+		mi.set(existingFrom+"_"+key, mi.Fields[key], mi.flags[key], existingFrom)
+	}
+
+	mi.set(key, field, flags, from)
+	return nil
+}
+
+func GetMappings(v interface{}, nameTag string, filterTag string, opts ...Option) *Info {
+	info, _ := GetMappingsE(v, nameTag, filterTag, opts...)
+	return info
 }
 
-func GetMappings(v interface{}, nameTag string, filterTag string) *Info {
+func GetMappingsE(v interface{}, nameTag string, filterTag string, opts ...Option) (*Info, error) {
+	return getMappings(v, nameTag, filterTag, newOptions(opts))
+}
+
+func getMappings(v interface{}, nameTag string, filterTag string, o *options) (*Info, error) {
 	if filterTag == "" {
 		filterTag = nameTag
 	}
 
 	mi := &Info{
-		Fields: make(map[string]FieldAdapter),
-		Extra:  nil,
+		Fields:   make(map[string]FieldAdapter),
+		Extra:    nil,
+		flags:    make(map[string]stringSet),
+		promoted: make(map[string]string),
+		embedded: make(map[string]bool),
 	}
 
-	for _, field := range newStructAdapter(v).Fields() {
-		if !field.HasTag(filterTag) {
-			continue
-		}
+	sa := newStructAdapter(v)
+	fields := sa.Fields()
+	plan, err := o.planCache().lookup(sa.T, fields, nameTag, filterTag, o)
+	if err != nil {
+		return nil, err
+	}
 
-		name, flags := parseNameAndFlags(field, nameTag)
-		if name != "-" {
-			fields, defaultField := parseField(field, name, nameTag, filterTag, flags)
-			if defaultField != nil {
-				mi.Extra = defaultField
-			}
+	for _, mf := range plan {
+		if mf.embedded {
+			mi.embedded[mf.name] = true
+		}
 
-			for k, v := range fields {
-				mi.Fields[k] = v
-			}
+		if err := parseField(mi, fields[mf.index], mf.name, nameTag, filterTag, mf.flags, o); err != nil {
+			return nil, err
 		}
 	}
 
-	return mi
+	return mi, nil
 }
 
-func TaggedToMap(v interface{}, nameTag string, filterTag string) map[string]interface{} {
-	info := GetMappings(v, nameTag, filterTag)
-	m := make(map[string]interface{})
-	for k, f := range info.Fields {
-		srcValue := f.Value()
-		value := srcValue
-		if isStruct(srcValue) {
-			value = ToMap(srcValue)
-		}
+// HasCatchAll reports whether v's struct type, or any struct inlined into it,
+// declares an inline map catch-all for unmatched keys.
+func HasCatchAll(v interface{}, opts ...Option) bool {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return false
+	}
 
-		m[k] = value
+	return TaggedHasCatchAllType(t, DefaultTag, DefaultTag, opts...)
+}
+
+func HasCatchAllType(t reflect.Type, opts ...Option) bool {
+	return TaggedHasCatchAllType(t, DefaultTag, DefaultTag, opts...)
+}
+
+func TaggedHasCatchAllType(t reflect.Type, nameTag string, filterTag string, opts ...Option) bool {
+	return hasCatchAll(baseType(t), nameTag, filterTag, newOptions(opts))
+}
+
+func hasCatchAll(t reflect.Type, nameTag string, filterTag string, o *options) bool {
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+
+	if filterTag == "" {
+		filterTag = nameTag
+	}
+
+	v := reflect.New(t).Interface()
+	info, err := getMappings(v, nameTag, filterTag, o)
+	if err != nil {
+		return false
 	}
 
 	if info.Extra != nil {
-		for _, key := range info.Extra.Keys() {
-			m[key] = info.Extra.Index(key)
+		return true
+	}
+
+	for _, field := range newStructAdapter(v).Fields() {
+		if !field.HasTag(filterTag) {
+			if promotesEmbedded(field, nameTag) && hasCatchAll(baseType(fieldType(field)), nameTag, filterTag, o) {
+				return true
+			}
+
+			continue
+		}
+
+		name, flags, err := parseNameAndFlags(field, nameTag, false)
+		if err != nil || name == "-" || !flags.Contains("inline") {
+			continue
+		}
+
+		if ft := baseType(fieldType(field)); ft.Kind() == reflect.Struct && hasCatchAll(ft, nameTag, filterTag, o) {
+			return true
 		}
 	}
 
-	return m
+	return false
 }
 
-func ToMap(v interface{}) map[string]interface{} {
-	return TaggedToMap(v, DefaultTag, DefaultTag)
+// promotesEmbedded reports whether field is an untagged, exported embedded
+// struct or struct pointer, whose fields are promoted as if it were tagged
+// inline, as encoding/json does.
+func promotesEmbedded(field Field, nameTag string) bool {
+	fh, ok := field.(*fieldHelper)
+	if !ok || !fh.F.Anonymous || !fh.IsExported() || fh.HasTag(nameTag) {
+		return false
+	}
+
+	return baseType(fh.F.Type).Kind() == reflect.Struct
 }
 
-func TaggedFromMap(m map[string]interface{}, dest interface{}, nameTag string, filterTag string) {
-	mappings := GetMappings(dest, nameTag, filterTag)
-	for key, srcValue := range m {
-		field, ok := mappings.Fields[key]
-		if !ok {
-			if mappings.Extra != nil {
-				mappings.Extra.SetIndex(key, srcValue)
+// planFields works out which of a struct's fields are mapped, under what
+// names and with which flags. It depends only on the struct's type.
+func planFields(fields []Field, nameTag string, filterTag string, o *options) ([]mappedField, error) {
+	var plan []mappedField
+	for i, field := range fields {
+		if !field.HasTag(filterTag) {
+			if !o.taggedOnly && promotesEmbedded(field, nameTag) {
+				plan = append(plan, mappedField{index: i, name: field.Name(), flags: newStringSet("inline"), embedded: true})
 			}
 
 			continue
 		}
 
-		destValue := srcValue
-		fieldKind := field.Kind()
-		if fieldKind == reflect.Struct || (fieldKind == reflect.Ptr && reflect.TypeOf(field.Value()).Elem().Kind() == reflect.Struct) {
-			if srcMap, ok := srcValue.(map[string]interface{}); ok {
-				if fieldKind == reflect.Ptr {
-					destValue = reflect.New(reflect.TypeOf(field.Value()).Elem()).Interface()
-				}
+		name, flags, err := parseNameAndFlags(field, nameTag, o.strictTags)
+		if err != nil {
+			return nil, err
+		}
+
+		if o.keyTransform != nil && name != "-" {
+			name = o.keyTransform(name)
+		}
+
+		// Unexported embedded interfaces such as error can't be read or set.
+		if fh, ok := field.(*fieldHelper); ok && embedsInterface(fh) && !fh.IsExported() {
+			continue
+		}
 
-				FromMap(srcMap, destValue)
+		if name != "-" && isUnsupportedKind(fieldType(field).Kind()) {
+			if o.skipUnsupported {
+				continue
+			}
+
+			if o.strictTypes {
+				return nil, fmt.Errorf("mapsmith: field %s: unsupported kind %s", field.Name(), fieldType(field).Kind())
 			}
 		}
 
-		field.Set(destValue)
+		if name != "-" {
+			plan = append(plan, mappedField{index: i, name: name, flags: flags})
+		}
 	}
+
+	return plan, nil
 }
 
-func FromMap(m map[string]interface{}, dest interface{}) {
-	TaggedFromMap(m, dest, DefaultTag, DefaultTag)
+func TaggedToMap(v interface{}, nameTag string, filterTag string, opts ...Option) map[string]interface{} {
+	m, _ := TaggedToMapE(v, nameTag, filterTag, opts...)
+	return m
 }
 
-func MapKeys(m map[string]interface{}, keyMap map[string]string) map[string]interface{} {
-	mapped := make(map[string]interface{})
-	for k, v := range m {
-		if mappedKey, ok := keyMap[k]; ok {
-			k = mappedKey
+func TaggedToMapE(v interface{}, nameTag string, filterTag string, opts ...Option) (map[string]interface{}, error) {
+	return encodeRoot(v, nameTag, filterTag, newOptions(opts))
+}
+
+func encodeRoot(v interface{}, nameTag string, filterTag string, o *options) (map[string]interface{}, error) {
+	m, err := toMap(v, nameTag, filterTag, o)
+	if err != nil {
+		return m, err
+	}
+
+	if o.typeNameKey != "" {
+		if _, exists := m[o.typeNameKey]; exists {
+			return m, fmt.Errorf("mapsmith: type name key %q collides with another field", o.typeNameKey)
 		}
 
-		mapped[k] = v
+		if t := reflect.TypeOf(v); t != nil {
+			m[o.typeNameKey] = o.typeName(baseType(t))
+		}
 	}
 
-	return mapped
+	if o.keyRewrite != nil {
+		m = rewriteKeys(m, o.keyRewrite)
+	}
+
+	if o.checksumKey != "" {
+		sum, err := checksum(m, o)
+		if err != nil {
+			return m, err
+		}
+
+		m[o.checksumKey] = sum
+	}
+
+	return m, nil
 }
 
-func Join(a map[string]interface{}, b map[string]interface{}) map[string]interface{} {
-	c := make(map[string]interface{})
-	for k, v := range a {
-		c[k] = v
+// rewriteKeys applies fn to each entry of m in sorted key order, dropping or
+// renaming it as fn says. A renamed entry overwrites any entry already
+// emitted under the new key.
+func rewriteKeys(m map[string]interface{}, fn func(key string, value interface{}) (string, bool)) map[string]interface{} {
+	rewritten := make(map[string]interface{}, len(m))
+	for _, k := range SortedKeys(m) {
+		if key, keep := fn(k, m[k]); keep {
+			rewritten[key] = m[k]
+		}
 	}
 
-	for k, v := range b {
-		c[k] = v
+	return rewritten
+}
+
+// EmptyFieldChecker is implemented by structs that decide centrally which of
+// their fields count as empty for omitempty. name is the Go field name.
+type EmptyFieldChecker interface {
+	IsEmptyField(name string) bool
+}
+
+var errBeyondDepth = errors.New("mapsmith: beyond max depth")
+
+// MapMarshaler is implemented by structs that produce their own map form.
+// It is used in place of the struct's fields wherever the struct is encoded,
+// whether passed to ToMap itself or held in a field.
+type MapMarshaler interface {
+	ToMapsmith() (map[string]interface{}, error)
+}
+
+var mapMarshalerType = reflect.TypeOf((*MapMarshaler)(nil)).Elem()
+
+// mapMarshaler returns v as a MapMarshaler, taking the address of a copy
+// when only the pointer type implements it.
+func mapMarshaler(v interface{}) (MapMarshaler, bool) {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() || (rv.Kind() == reflect.Ptr && rv.IsNil()) {
+		return nil, false
 	}
 
-	return c
+	if mm, ok := v.(MapMarshaler); ok {
+		return mm, true
+	}
+
+	if rv.Kind() != reflect.Ptr && reflect.PtrTo(rv.Type()).Implements(mapMarshalerType) {
+		p := reflect.New(rv.Type())
+		p.Elem().Set(rv)
+		mm, ok := p.Interface().(MapMarshaler)
+		return mm, ok
+	}
+
+	return nil, false
 }
 
-func FilterMap(m map[string]interface{}, allowedKeys []string) map[string]interface{} {
-	var ok bool
-	var v interface{}
-	r := map[string]interface{}{}
+func toMap(v interface{}, nameTag string, filterTag string, o *options) (map[string]interface{}, error) {
+	if mm, ok := mapMarshaler(v); ok {
+		return mm.ToMapsmith()
+	}
+
+	info, err := getMappings(v, nameTag, filterTag, o)
+	if err != nil {
+		return nil, err
+	}
+
+	fieldOpts := o
+	if o.maxDepth > 0 {
+		child := *o
+		child.depth++
+		fieldOpts = &child
+	}
+
+	if err := checkGroups(info); err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]interface{})
+	for _, k := range info.keys(o.deterministic) {
+		f := info.Fields[k]
+		flags := info.flags[k]
+		// whole fields hold a copy of the source and are never encoded.
+		if flags.Contains("whole") || (o.onlyFlag != "" && !flags.Contains(o.onlyFlag)) {
+			continue
+		}
+
+		var submask fieldMask
+		if o.mask != nil {
+			next, ok := o.mask[k]
+			if !ok {
+				continue
+			}
+
+			submask = next
+		}
+
+		// keep beats WithOmitEmpty, which beats the field's own omitempty.
+		if !flags.Contains("keep") && (o.omitEmpty || flags.Contains("omitempty")) && isEmptyField(v, f) {
+			continue
+		}
+
+		// An embedded interface is only encoded while it holds a struct.
+		if embedsInterface(f) && !isStruct(f.Value()) {
+			continue
+		}
+
+		if o.omitDefaults {
+			isDefault, err := equalsDefault(f, info.flags[k])
+			if err != nil {
+				return m, fmt.Errorf("mapsmith: field %q: %w", k, err)
+			}
+
+			if isDefault {
+				continue
+			}
+		}
+
+		encodeOpts := fieldOpts
+		if o.mask != nil {
+			child := *fieldOpts
+			child.mask = submask
+			encodeOpts = &child
+		}
+
+		var value interface{}
+		if flags.Contains("secret") && !o.unredacted {
+			value = o.redact(f.Value())
+		} else if o.jsonValues {
+			if value, err = jsonValue(f.Value()); err != nil {
+				return m, fmt.Errorf("mapsmith: field %q: %w", k, err)
+			}
+		} else {
+			value, err = encodeField(f.Value(), fieldType(f), info.flags[k], nameTag, filterTag, encodeOpts)
+			if err == errBeyondDepth {
+				continue
+			} else if err == ErrNonFiniteFloat {
+				return m, &FieldError{Key: k, Err: err}
+			} else if err != nil {
+				return m, err
+			}
+		}
+
+		if prefix, ok := info.flags[k].Param("scope"); ok && prefix != "" {
+			if nested, ok := value.(map[string]interface{}); ok {
+				for nk, nv := range nested {
+					m[prefix+nk] = nv
+				}
+
+				continue
+			}
+		}
+
+		if group, ok := info.flags[k].Param("group"); ok && group != "" {
+			nested, ok := m[group].(map[string]interface{})
+			if !ok {
+				if _, exists := m[group]; exists {
+					return m, fmt.Errorf("mapsmith: group %q collides with another field", group)
+				}
+
+				nested = make(map[string]interface{})
+				m[group] = nested
+			}
+
+			nested[k] = value
+			continue
+		}
+
+		m[k] = value
+	}
+
+	if info.Extra != nil {
+		extraKeys := info.Extra.Keys()
+		if o.deterministic {
+			sort.Strings(extraKeys)
+		}
+
+		for _, key := range extraKeys {
+			value, err := encodeValue(info.Extra.Index(key), nameTag, filterTag, fieldOpts)
+			if err == errBeyondDepth {
+				continue
+			} else if err != nil {
+				return m, err
+			}
+
+			m[key] = value
+		}
+	}
+
+	return m, nil
+}
+
+// checkGroups rejects a group= name that is also a field's key. It checks
+// every field up front so the result doesn't depend on the encoding order.
+func checkGroups(info *Info) error {
+	for _, k := range info.keys(true) {
+		if group, ok := info.flags[k].Param("group"); ok && group != "" {
+			if _, exists := info.Fields[group]; exists {
+				return fmt.Errorf("mapsmith: group %q collides with another field", group)
+			}
+		}
+	}
+
+	return nil
+}
+
+func isEmptyField(parent interface{}, f FieldAdapter) bool {
+	if checker, ok := parent.(EmptyFieldChecker); ok {
+		if name := fieldName(f); name != "" {
+			return checker.IsEmptyField(name)
+		}
+	}
+
+	return isEmptyValue(f.Value(), fieldType(f))
+}
+
+func equalsDefault(f FieldAdapter, flags stringSet) (bool, error) {
+	literal, ok := flags.Param("default")
+	if !ok {
+		return false, nil
+	}
+
+	def, err := parseString(literal, fieldType(f))
+	if err != nil {
+		return false, fmt.Errorf("invalid default: %w", err)
+	}
+
+	return reflect.DeepEqual(f.Value(), def), nil
+}
+
+// jsonValue round-trips v through encoding/json, leaving the generic value
+// json.Unmarshal produces: maps, slices, float64s, strings, bools or nil.
+func jsonValue(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var out interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+func encodeField(v interface{}, fieldType reflect.Type, flags stringSet, nameTag string, filterTag string, o *options) (interface{}, error) {
+	if flags.Contains("bytestring") && isBytesType(fieldType) {
+		return string(reflect.ValueOf(v).Bytes()), nil
+	}
+
+	if isTimeType(fieldType) && (flags.Contains("unix") || flags.Contains("unixmilli")) {
+		return encodeEpoch(v, flags.Contains("unixmilli")), nil
+	}
+
+	if sep, ok := flags.Param("split"); ok && fieldType.Kind() == reflect.Slice && !isBytesType(fieldType) {
+		return joinSlice(v, sep), nil
+	}
+
+	if flags.Contains("char") && isCharKind(baseType(fieldType).Kind()) {
+		rv := reflect.ValueOf(v)
+		if fieldType.Kind() == reflect.Ptr {
+			if rv.IsNil() {
+				return nil, nil
+			}
+
+			rv = rv.Elem()
+		}
+
+		return encodeChar(rv), nil
+	}
+
+	return encodeValue(v, nameTag, filterTag, o)
+}
+
+func encodeValue(v interface{}, nameTag string, filterTag string, o *options) (interface{}, error) {
+	if rv := reflect.ValueOf(v); rv.IsValid() && !(rv.Kind() == reflect.Ptr && rv.IsNil()) {
+		if c, ok := o.converter(rv.Type()); ok {
+			return c.to(v), nil
+		}
+
+		if rv.Kind() == reflect.Ptr {
+			if c, ok := o.converter(rv.Type().Elem()); ok {
+				return c.to(rv.Elem().Interface()), nil
+			}
+		}
+	}
+
+	if isStruct(v) {
+		if o.maxDepth > 0 && o.depth > o.maxDepth {
+			return beyondDepth(v, o)
+		}
+
+		return toMap(v, nameTag, filterTag, o)
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil, nil
+		}
+
+		return encodeValue(rv.Elem().Interface(), nameTag, filterTag, o)
+	}
+
+	if rv.Kind() == reflect.Slice && rv.IsNil() && isStructType(rv.Type().Elem()) {
+		return []map[string]interface{}(nil), nil
+	}
+
+	if (rv.Kind() == reflect.Slice && !rv.IsNil()) || rv.Kind() == reflect.Array {
+		elemType := rv.Type().Elem()
+		if isStructType(elemType) {
+			if o.maxDepth > 0 && o.depth > o.maxDepth {
+				return beyondDepth(v, o)
+			}
+
+			items := make([]map[string]interface{}, rv.Len())
+			for i := range items {
+				elem := rv.Index(i)
+				if elem.Kind() == reflect.Ptr && elem.IsNil() {
+					continue
+				}
+
+				item, err := toMap(elem.Interface(), nameTag, filterTag, o)
+				if err != nil {
+					return nil, err
+				}
+
+				items[i] = item
+			}
+
+			return items, nil
+		}
+
+		if elemType.Kind() == reflect.Interface {
+			items := make([]interface{}, rv.Len())
+			for i := range items {
+				item, err := encodeValue(rv.Index(i).Interface(), nameTag, filterTag, o)
+				if err != nil {
+					return nil, err
+				}
+
+				items[i] = item
+			}
+
+			return items, nil
+		}
+	}
+
+	if rv.Kind() == reflect.Map && !rv.IsNil() && rv.Type().Key().Kind() == reflect.String {
+		if elemType := rv.Type().Elem(); isStructType(elemType) || elemType.Kind() == reflect.Interface {
+			items := make(map[string]interface{}, rv.Len())
+			keys := rv.MapKeys()
+			if o.deterministic {
+				// Encode entries in key order so that errors and converters
+				// see them the same way on every run.
+				sort.Slice(keys, func(i, j int) bool {
+					return keys[i].String() < keys[j].String()
+				})
+			}
+
+			for _, key := range keys {
+				item, err := encodeValue(rv.MapIndex(key).Interface(), nameTag, filterTag, o)
+				if err == errBeyondDepth {
+					continue
+				} else if err != nil {
+					return nil, err
+				}
+
+				items[key.String()] = item
+			}
+
+			return items, nil
+		}
+	}
+
+	if o.nonFinite != NonFiniteRaw && (rv.Kind() == reflect.Float32 || rv.Kind() == reflect.Float64) {
+		if f := rv.Float(); math.IsNaN(f) || math.IsInf(f, 0) {
+			switch o.nonFinite {
+			case NonFiniteError:
+				return nil, ErrNonFiniteFloat
+			case NonFiniteNull:
+				return nil, nil
+			default:
+				return strconv.FormatFloat(f, 'g', -1, 64), nil
+			}
+		}
+	}
+
+	if o.complexes != ComplexRaw && isComplexKind(rv.Kind()) {
+		return encodeComplex(rv, o.complexes), nil
+	}
+
+	if o.typedValues {
+		return wrapTyped(v), nil
+	}
+
+	return v, nil
+}
+
+// beyondDepth stands in for a value nested deeper than WithMaxDepth allows:
+// its type name under the placeholder mode, otherwise errBeyondDepth so the
+// field is left out.
+func beyondDepth(v interface{}, o *options) (interface{}, error) {
+	if o.depthPlaceholder {
+		return reflect.TypeOf(v).String(), nil
+	}
+
+	return nil, errBeyondDepth
+}
+
+func ToMap(v interface{}, opts ...Option) map[string]interface{} {
+	return TaggedToMap(v, DefaultTag, DefaultTag, opts...)
+}
+
+func ToMapE(v interface{}, opts ...Option) (map[string]interface{}, error) {
+	return TaggedToMapE(v, DefaultTag, DefaultTag, opts...)
+}
+
+// ToMapUnredacted is ToMapE with fields flagged secret encoded as they are
+// rather than redacted, for storage rather than display.
+func ToMapUnredacted(v interface{}, opts ...Option) (map[string]interface{}, error) {
+	return ToMapE(v, append(opts, withUnredacted())...)
+}
+
+// ToSortedJSON encodes v with WithDeterministicOutput and marshals it to
+// JSON, which sorts the keys of every map at every level.
+func ToSortedJSON(v interface{}, opts ...Option) ([]byte, error) {
+	m, err := ToMapE(v, append(opts, WithDeterministicOutput())...)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(m)
+}
+
+// ToMapWithFlag encodes only the fields whose map tag carries flag, as in
+// `map:"email,public"`. The filter applies at every level, so nested struct
+// fields must carry the flag too.
+func ToMapWithFlag(v interface{}, flag string, opts ...Option) map[string]interface{} {
+	return TaggedToMap(v, DefaultTag, DefaultTag, append(opts, func(o *options) {
+		o.onlyFlag = flag
+	})...)
+}
+
+// fieldMask is a tree of dotted mask paths. A key mapped to nil is included
+// with everything beneath it.
+type fieldMask map[string]fieldMask
+
+func newFieldMask(paths []string) fieldMask {
+	mask := fieldMask{}
+	for _, path := range paths {
+		node := mask
+		parts := strings.Split(path, ".")
+		for i, part := range parts {
+			next, seen := node[part]
+			if seen && next == nil {
+				break
+			}
+
+			if i == len(parts)-1 {
+				node[part] = nil
+				break
+			}
+
+			if next == nil {
+				next = fieldMask{}
+				node[part] = next
+			}
+
+			node = next
+		}
+	}
+
+	return mask
+}
+
+// ToMapMask encodes only the dotted paths in mask, such as "db.host", along
+// with the ancestors needed to reach them. A path naming a struct includes
+// all of it, and fields outside the mask are never converted.
+func ToMapMask(v interface{}, mask []string, opts ...Option) map[string]interface{} {
+	return TaggedToMap(v, DefaultTag, DefaultTag, append(opts, func(o *options) {
+		o.mask = newFieldMask(mask)
+	})...)
+}
+
+// ToKeyedMap encodes each struct in slice and stores it under the string form
+// of its field mapped to keyField, e.g. turning []Item into a map keyed by
+// each item's "id". Two items with the same key are an error.
+func ToKeyedMap(slice interface{}, keyField string, opts ...Option) (map[string]interface{}, error) {
+	rv := reflect.ValueOf(slice)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("mapsmith: ToKeyedMap of non-slice %T", slice)
+	}
+
+	o := newOptions(opts)
+	keyed := make(map[string]interface{}, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		item := rv.Index(i).Interface()
+		if !isStruct(item) {
+			return nil, fmt.Errorf("mapsmith: index %d: expected a struct, got %T", i, item)
+		}
+
+		info, err := getMappings(item, DefaultTag, DefaultTag, o)
+		if err != nil {
+			return nil, err
+		}
+
+		field, ok := info.Fields[keyField]
+		if !ok {
+			return nil, fmt.Errorf("mapsmith: index %d: no field mapped to %q", i, keyField)
+		}
+
+		key := fmt.Sprint(reflect.Indirect(reflect.ValueOf(field.Value())))
+		if _, dup := keyed[key]; dup {
+			return nil, fmt.Errorf("mapsmith: index %d: duplicate key %q", i, key)
+		}
+
+		m, err := toMap(item, DefaultTag, DefaultTag, o)
+		if err != nil {
+			return nil, err
+		}
+
+		keyed[key] = m
+	}
+
+	return keyed, nil
+}
+
+// ToMapTaggedOnly encodes only the fields carrying a map tag. Unlike ToMap it
+// doesn't promote the fields of untagged embedded structs; use it when code
+// depends on untagged fields never being emitted.
+func ToMapTaggedOnly(v interface{}, opts ...Option) map[string]interface{} {
+	return TaggedToMap(v, DefaultTag, DefaultTag, append(opts, func(o *options) {
+		o.taggedOnly = true
+	})...)
+}
+
+// Defaulter is implemented by destinations that set their own defaults.
+// SetDefaults runs first, before PreDecode, then source values are applied,
+// then default= tags fill keys still absent, then required keys are checked;
+// a required field left non-zero by either kind of default passes. It is not
+// called under WithPatch.
+type Defaulter interface {
+	SetDefaults()
+}
+
+// PreDecoder is implemented by destinations that want to inspect the source
+// map or set defaults before any of its values are applied.
+type PreDecoder interface {
+	PreDecode(m map[string]interface{})
+}
+
+// PostDecoder is implemented by destinations that want to normalize or
+// validate themselves once every field, including nested structs, has been
+// populated.
+type PostDecoder interface {
+	PostDecode() error
+}
+
+// Validator is implemented by destinations that check their own invariants.
+// Validate runs after PostDecode; an error is reported as a FieldError at the
+// struct's path, so a nested struct's failure names the field it sits in.
+type Validator interface {
+	Validate() error
+}
+
+func TaggedFromMap(m map[string]interface{}, dest interface{}, nameTag string, filterTag string, opts ...Option) {
+	_ = TaggedFromMapE(m, dest, nameTag, filterTag, opts...)
+}
+
+func TaggedFromMapE(m map[string]interface{}, dest interface{}, nameTag string, filterTag string, opts ...Option) error {
+	return newDecoder(nameTag, filterTag, newOptions(opts)).decodeRoot(m, dest)
+}
+
+type decoder struct {
+	o         *options
+	nameTag   string
+	filterTag string
+
+	// extras collects top-level source keys that matched no field, when
+	// non-nil.
+	extras map[string]interface{}
+	errs   []*FieldError
+
+	// audit enables collecting a DecodeRecord for every value set.
+	audit   bool
+	records []DecodeRecord
+
+	// parseStrings parses string sources left over once every other
+	// coercion has been tried into the field's kind, as for url.Values.
+	parseStrings bool
+}
+
+var errDecodeAborted = errors.New("mapsmith: decode aborted")
+
+// fail records a field error and returns errDecodeAborted when decoding
+// should stop, i.e. under WithFailFast.
+func (d *decoder) fail(path string, err error) error {
+	if err == errDecodeAborted {
+		return err
+	}
+
+	d.errs = append(d.errs, &FieldError{Key: path, Err: err})
+	if d.o.failFast {
+		return errDecodeAborted
+	}
+
+	return nil
+}
+
+func newDecoder(nameTag string, filterTag string, o *options) *decoder {
+	return &decoder{
+		o:         o,
+		nameTag:   nameTag,
+		filterTag: filterTag,
+	}
+}
+
+func (d *decoder) decodeRoot(m map[string]interface{}, dest interface{}) error {
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || (!isMapPointer(dest) && rv.Elem().Kind() != reflect.Struct) {
+		return fmt.Errorf("mapsmith: cannot decode into %T; dest must be a non-nil pointer to a struct or map", dest)
+	}
+
+	if d.o.checksumKey != "" {
+		verified, err := verifyChecksum(m, d.o)
+		if err != nil {
+			return err
+		}
+
+		m = verified
+	}
+
+	decode := d.decode
+	if isMapPointer(dest) {
+		decode = d.decodeMap
+	}
+
+	if err := decode(m, dest, ""); err != nil && err != errDecodeAborted {
+		return err
+	}
+
+	if len(d.errs) > 0 {
+		return newDecodeError(d.errs)
+	}
+
+	return nil
+}
+
+// decodeChain decodes maps into dest as one layered source. It reports
+// errors the way decodeRoot does.
+func (d *decoder) decodeChain(maps []map[string]interface{}, dest interface{}) error {
+	if rv := reflect.ValueOf(dest); rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("mapsmith: cannot decode into %T; dest must be a non-nil pointer to a struct", dest)
+	}
+
+	if err := d.decodeLayers(maps, dest); err != nil && err != errDecodeAborted {
+		return err
+	}
+
+	if len(d.errs) > 0 {
+		return newDecodeError(d.errs)
+	}
+
+	return nil
+}
+
+// decodeLayers decodes the first value each key has across maps into dest,
+// without merging the maps.
+func (d *decoder) decodeLayers(maps []map[string]interface{}, dest interface{}) error {
+	mappings, err := getMappings(dest, d.nameTag, d.filterTag, d.o)
+	if err != nil {
+		return err
+	}
+
+	if def, ok := dest.(Defaulter); ok {
+		def.SetDefaults()
+	}
+
+	layers := make([]map[string]interface{}, len(maps))
+	for i, m := range maps {
+		layers[i] = applyGroups(applyScopes(m, mappings), mappings)
+	}
+
+	seen := make(map[string]bool)
+	for _, m := range layers {
+		for key, srcValue := range m {
+			if seen[key] {
+				continue
+			}
+
+			seen[key] = true
+			if err := d.decodeKey(mappings, key, srcValue, ""); err != nil {
+				return err
+			}
+		}
+	}
+
+	return d.finish(dest, mappings, func(key string) bool {
+		return seen[key]
+	}, "")
+}
+
+func (d *decoder) decode(m map[string]interface{}, dest interface{}, path string) error {
+	mappings, err := getMappings(dest, d.nameTag, d.filterTag, d.o)
+	if err != nil {
+		return err
+	}
+
+	if def, ok := dest.(Defaulter); ok && !d.o.patch {
+		def.SetDefaults()
+	}
+
+	if pre, ok := dest.(PreDecoder); ok {
+		pre.PreDecode(m)
+	}
+
+	if err := d.decodeWhole(m, mappings, path); err != nil {
+		return err
+	}
+
+	if d.o.absentSentinel != nil {
+		m = dropSentinel(m, *d.o.absentSentinel)
+	}
+
+	m = applyScopes(m, mappings)
+	m = applyGroups(m, mappings)
+	if d.o.looseKeys {
+		if m, err = d.applyLooseKeys(m, mappings, path, normalizeKey, "loose"); err != nil {
+			return err
+		}
+	} else if d.o.caseInsensitive {
+		if m, err = d.applyLooseKeys(m, mappings, path, strings.ToLower, "case-insensitive"); err != nil {
+			return err
+		}
+	}
+
+	for key, srcValue := range m {
+		if err := d.decodeKey(mappings, key, srcValue, path); err != nil {
+			return err
+		}
+	}
+
+	return d.finish(dest, mappings, func(key string) bool {
+		_, ok := m[key]
+		return ok
+	}, path)
+}
+
+// decodeKey decodes one source entry into its field, or into the catch-all
+// when no field maps key.
+func (d *decoder) decodeKey(mappings *Info, key string, srcValue interface{}, path string) error {
+	if d.o.typedValues {
+		srcValue = unwrapTyped(srcValue)
+	}
+
+	field, ok := mappings.Fields[key]
+	if ok && mappings.flags[key].Contains("whole") {
+		ok = false
+	}
+
+	if !ok {
+		if path == "" && d.extras != nil {
+			d.extras[key] = srcValue
+		}
+
+		if mappings.Extra != nil {
+			if err := setIndex(mappings.Extra, key, srcValue); err != nil {
+				return d.fail(joinPath(path, key), err)
+			}
+
+			d.record(fieldName(mappings.Extra), joinPath(path, key), srcValue, mappings.Extra.Index(key))
+		} else if d.o.disallowUnknown {
+			if err := d.fail(joinPath(path, key), ErrUnknownKey); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	fieldPath := joinPath(path, key)
+	if raw, ok, err := rawJSON(srcValue, fieldType(field), mappings.flags[key]); ok {
+		if err != nil {
+			return d.fail(fieldPath, err)
+		}
+
+		srcValue = raw
+	}
+
+	if d.o.patch {
+		patched, err := d.patchField(field, srcValue, fieldPath)
+		if err != nil {
+			return err
+		}
+
+		if patched {
+			d.record(fieldName(field), fieldPath, srcValue, field.Value())
+			return nil
+		}
+	}
+
+	destValue, err := d.decodeValue(srcValue, fieldType(field), mappings.flags[key], fieldPath)
+	if err != nil {
+		return d.fail(fieldPath, err)
+	}
+
+	err = setField(field, destValue)
+	if err == nil && d.o.postProcess != nil {
+		err = setField(field, d.o.postProcess(fieldName(field), field.Value()))
+	}
+
+	if err != nil {
+		return d.fail(fieldPath, err)
+	}
+
+	d.record(fieldName(field), fieldPath, srcValue, field.Value())
+	if flags := mappings.flags[key]; hasBounds(flags) {
+		if err := validateBounds(field.Value(), flags); err != nil {
+			if err := d.fail(fieldPath, err); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// finish applies defaults, checks required keys against present and runs the
+// destination's hooks once its fields are decoded.
+func (d *decoder) finish(dest interface{}, mappings *Info, present func(key string) bool, path string) error {
+	if err := d.applyDefaults(present, mappings, path); err != nil {
+		return err
+	}
+
+	for key, flags := range mappings.flags {
+		// A required key may be absent when a default already gave the
+		// field a non-zero value.
+		if !present(key) && flags.Contains("required") && isZeroValue(mappings.Fields[key].Value(), fieldType(mappings.Fields[key])) {
+			if err := d.fail(joinPath(path, key), ErrRequiredMissing); err != nil {
+				return err
+			}
+		}
+
+		other, ok := flags.Param("requiredWith")
+		if !ok {
+			continue
+		}
+
+		if present(key) {
+			continue
+		}
+
+		if present(other) {
+			if err := d.fail(joinPath(path, key), fmt.Errorf("required when %q is present", other)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if post, ok := dest.(PostDecoder); ok {
+		if err := post.PostDecode(); err != nil {
+			return d.fail(path, err)
+		}
+	}
+
+	if v, ok := dest.(Validator); ok {
+		if err := v.Validate(); err != nil {
+			return d.fail(path, err)
+		}
+	}
+
+	return nil
+}
+
+func isMapPointer(v interface{}) bool {
+	t := reflect.TypeOf(v)
+	return t != nil && t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Map && t.Elem().Key().Kind() == reflect.String
+}
+
+// decodeMap populates the map dest points to, allocating it when nil and
+// coercing every source value to the map's element type.
+func (d *decoder) decodeMap(m map[string]interface{}, dest interface{}, path string) error {
+	target := reflect.ValueOf(dest).Elem()
+	if target.IsNil() {
+		target.Set(reflect.MakeMapWithSize(target.Type(), len(m)))
+	}
+
+	return d.decodeEntries(m, target, path)
+}
+
+// decodeEntries stores every entry of m in target, parsing each key for the
+// map's key type and decoding each value into its element type. A struct
+// element with a field flagged mapkey gets the entry's key there, too.
+func (d *decoder) decodeEntries(m map[string]interface{}, target reflect.Value, path string) error {
+	t := target.Type()
+	for k, v := range m {
+		itemPath := joinPath(path, k)
+		key, err := parseString(k, t.Key())
+		var next, keyValue reflect.Value
+		if err == nil {
+			keyValue, err = assignable(key, t.Key())
+		}
+
+		if err == nil {
+			var item interface{}
+			if item, err = d.decodeValue(v, t.Elem(), nil, itemPath); err == nil {
+				if next, err = assignable(item, t.Elem()); err == nil && isStructType(t.Elem()) {
+					next, err = d.injectMapKey(next, k)
+				}
+			}
+		}
+
+		if err != nil {
+			if err := d.fail(itemPath, err); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		target.SetMapIndex(keyValue, next)
+	}
+
+	return nil
+}
+
+// injectMapKey sets the field of struct v flagged mapkey, if any, to key
+// parsed for that field's type, returning the updated value.
+func (d *decoder) injectMapKey(v reflect.Value, key string) (reflect.Value, error) {
+	ptr := v
+	if v.Kind() != reflect.Ptr {
+		ptr = reflect.New(v.Type())
+		ptr.Elem().Set(v)
+	} else if v.IsNil() {
+		return v, nil
+	}
+
+	mappings, err := getMappings(ptr.Interface(), d.nameTag, d.filterTag, d.o)
+	if err != nil {
+		return v, err
+	}
+
+	for name, flags := range mappings.flags {
+		if !flags.Contains("mapkey") {
+			continue
+		}
+
+		field := mappings.Fields[name]
+		value, err := parseString(key, fieldType(field))
+		if err == nil {
+			err = setField(field, value)
+		}
+
+		if err != nil {
+			return v, fmt.Errorf("map key %q: %w", key, err)
+		}
+	}
+
+	if v.Kind() != reflect.Ptr {
+		return ptr.Elem(), nil
+	}
+
+	return ptr, nil
+}
+
+// applyDefaults sets fields whose key is absent from m to their default=
+// literal, parsed for the field's type. With the default-if-zero flag a
+// present value that decoded to zero is replaced too. Under WithPatch absent
+// keys keep their current values instead.
+func (d *decoder) applyDefaults(present func(key string) bool, mappings *Info, path string) error {
+	for key, flags := range mappings.flags {
+		literal, ok := flags.Param("default")
+		if !ok {
+			continue
+		}
+
+		field := mappings.Fields[key]
+		if present(key) {
+			if !flags.Contains("default-if-zero") || !isZeroValue(field.Value(), fieldType(field)) {
+				continue
+			}
+		} else if d.o.patch {
+			continue
+		}
+
+		fieldPath := joinPath(path, key)
+		value, err := parseString(literal, fieldType(field))
+		if err == nil {
+			err = setField(field, value)
+		}
+
+		if err != nil {
+			if err := d.fail(fieldPath, fmt.Errorf("invalid default: %w", err)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// decodeWhole hands a copy of the entire source map to every field tagged
+// whole, decoding it as a struct when the field is one.
+func (d *decoder) decodeWhole(m map[string]interface{}, mappings *Info, path string) error {
+	for key, flags := range mappings.flags {
+		if !flags.Contains("whole") {
+			continue
+		}
+
+		raw := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			raw[k] = v
+		}
+
+		field := mappings.Fields[key]
+		value, err := d.decodeValue(raw, fieldType(field), nil, path)
+		if err != nil {
+			if err := d.fail(path, err); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if err := setField(field, value); err != nil {
+			if err := d.fail(path, err); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// patchField updates a map or struct field in place from a map source,
+// allocating the field first when it is nil. It reports false when the field
+// should be decoded normally instead.
+func (d *decoder) patchField(field FieldAdapter, srcValue interface{}, path string) (bool, error) {
+	srcMap, ok := srcValue.(map[string]interface{})
+	if !ok {
+		return false, nil
+	}
+
+	t := fieldType(field)
+	switch {
+	case t.Kind() == reflect.Map && t.Key().Kind() == reflect.String:
+		current := reflect.ValueOf(field.Value())
+		if current.IsNil() {
+			current = reflect.MakeMapWithSize(t, len(srcMap))
+			if err := setField(field, current.Interface()); err != nil {
+				return true, d.fail(path, err)
+			}
+		}
+
+		for k, v := range srcMap {
+			itemPath := joinPath(path, k)
+			item, err := d.decodeValue(v, t.Elem(), nil, itemPath)
+			if err != nil {
+				if err := d.fail(itemPath, err); err != nil {
+					return true, err
+				}
+
+				continue
+			}
+
+			next, err := assignable(item, t.Elem())
+			if err != nil {
+				if err := d.fail(itemPath, err); err != nil {
+					return true, err
+				}
+
+				continue
+			}
+
+			current.SetMapIndex(reflect.ValueOf(k).Convert(t.Key()), next)
+		}
+
+		return true, nil
+	case t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct:
+		current := reflect.ValueOf(field.Value())
+		if current.IsNil() {
+			current = reflect.New(t.Elem())
+			if err := setField(field, current.Interface()); err != nil {
+				return true, d.fail(path, err)
+			}
+		}
+
+		return true, d.decode(srcMap, current.Interface(), path)
+	case t.Kind() == reflect.Struct:
+		current := reflect.New(t)
+		current.Elem().Set(reflect.ValueOf(field.Value()))
+		if err := d.decode(srcMap, current.Interface(), path); err != nil {
+			return true, err
+		}
+
+		if err := setField(field, current.Elem().Interface()); err != nil {
+			return true, d.fail(path, err)
+		}
+
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// rawJSON unmarshals a json.RawMessage source, or a []byte one under the
+// json flag, for a struct, slice, array or map field so it can be decoded like
+// any other value. The second result is false when srcValue isn't raw JSON.
+func rawJSON(srcValue interface{}, fieldType reflect.Type, flags stringSet) (interface{}, bool, error) {
+	var data []byte
+	switch raw := srcValue.(type) {
+	case json.RawMessage:
+		data = raw
+	case []byte:
+		if !flags.Contains("json") {
+			return nil, false, nil
+		}
+
+		data = raw
+	default:
+		return nil, false, nil
+	}
+
+	switch baseType(fieldType).Kind() {
+	case reflect.Struct, reflect.Slice, reflect.Array, reflect.Map:
+		if isBytesType(fieldType) {
+			return nil, false, nil
+		}
+	default:
+		return nil, false, nil
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, true, fmt.Errorf("invalid raw JSON: %w", err)
+	}
+
+	return v, true, nil
+}
+
+func (d *decoder) decodeValue(srcValue interface{}, fieldType reflect.Type, flags stringSet, path string) (interface{}, error) {
+	if key, ok := flags.Param("unwrap"); ok && key != "" {
+		if wrapped, ok := srcValue.(map[string]interface{}); ok {
+			value, ok := wrapped[key]
+			if !ok {
+				return nil, fmt.Errorf("expected key %q to unwrap", key)
+			}
+
+			srcValue = value
+		}
+	}
+
+	if raw, ok, err := rawJSON(srcValue, fieldType, flags); ok {
+		if err != nil {
+			return nil, err
+		}
+
+		srcValue = raw
+	}
+
+	// Epoch flags and WithTimeLayouts come before the time converter.
+	if isTimeType(fieldType) && (flags.Contains("unix") || flags.Contains("unixmilli")) {
+		return decodeEpoch(srcValue, fieldType, flags.Contains("unixmilli"))
+	}
+
+	if isTimeType(fieldType) && len(d.o.timeLayouts) > 0 {
+		return decodeLayouts(srcValue, fieldType, d.o.timeLayouts)
+	}
+
+	if srcValue != nil {
+		if c, ok := d.o.converter(fieldType); ok {
+			return c.from(srcValue, fieldType)
+		}
+
+		if fieldType.Kind() == reflect.Ptr {
+			if c, ok := d.o.converter(fieldType.Elem()); ok {
+				v, err := c.from(srcValue, fieldType.Elem())
+				if err != nil || v == nil || !reflect.TypeOf(v).ConvertibleTo(fieldType.Elem()) {
+					return v, err
+				}
+
+				return asType(v, fieldType), nil
+			}
+		}
+	}
+
+	if str, ok := srcValue.(string); ok && d.o.stripQuotes && baseType(fieldType).Kind() == reflect.String {
+		srcValue = stripQuotes(str)
+	}
+
+	if sep, ok := flags.Param("split"); ok && fieldType.Kind() == reflect.Slice && !isBytesType(fieldType) {
+		if str, ok := srcValue.(string); ok {
+			return splitString(str, sep, flags.Contains("trim"), fieldType)
+		}
+	}
+
+	if str, ok := srcValue.(string); ok && flags.Contains("char") && isCharKind(baseType(fieldType).Kind()) {
+		return decodeChar(str, fieldType)
+	}
+
+	if flags.Contains("bytestring") && isBytesType(fieldType) {
+		if str, ok := srcValue.(string); ok {
+			return reflect.ValueOf([]byte(str)).Convert(fieldType).Interface(), nil
+		}
+	}
+
+	if str, ok := srcValue.(string); ok && d.o.boolStrings && baseType(fieldType).Kind() == reflect.Bool {
+		b, err := parseBoolString(str, d.o.truthy, d.o.falsy)
+		if err != nil {
+			return nil, err
+		}
+
+		return asType(b, fieldType), nil
+	}
+
+	if d.o.numericBools != numericBoolsOff && baseType(fieldType).Kind() == reflect.Bool {
+		if b, ok, err := numericBool(srcValue, d.o.numericBools == numericBoolsStrict); ok {
+			if err != nil {
+				return nil, err
+			}
+
+			return asType(b, fieldType), nil
+		}
+	}
+
+	if str, ok := srcValue.(string); ok {
+		if v, ok, err := parseUnit(str, fieldType); ok {
+			return v, err
+		}
+	}
+
+	if d.o.complexes != ComplexRaw && isComplexKind(baseType(fieldType).Kind()) {
+		if c, ok, err := decodeComplex(srcValue, fieldType); ok {
+			return c, err
+		}
+	}
+
+	if fieldType.Kind() == reflect.Interface {
+		if srcMap, ok := srcValue.(map[string]interface{}); ok {
+			if t, ok := resolveType(srcMap, fieldType, d.nameTag, d.filterTag, d.o); ok {
+				return d.decodeValue(srcMap, t, flags, path)
+			}
+
+			if d.o.copyMaps {
+				return deepCopy(srcMap), nil
+			}
+		}
+	}
+
+	if isStructType(fieldType) {
+		srcMap, ok := srcValue.(map[string]interface{})
+		if !ok {
+			if srcValue == nil || reflect.TypeOf(srcValue).AssignableTo(fieldType) {
+				return srcValue, nil
+			}
+
+			return nil, fmt.Errorf("expected a map for %s, got %T", fieldType, srcValue)
+		}
+
+		if srcMap == nil && fieldType.Kind() == reflect.Ptr {
+			return nil, nil
+		}
+
+		instance := reflect.New(fieldType)
+		if fieldType.Kind() == reflect.Ptr {
+			instance = reflect.New(fieldType.Elem())
+		}
+
+		if err := d.decode(srcMap, instance.Interface(), path); err != nil {
+			return nil, err
+		}
+
+		if fieldType.Kind() == reflect.Ptr {
+			return instance.Interface(), nil
+		}
+
+		return instance.Elem().Interface(), nil
+	}
+
+	if fieldType.Kind() == reflect.Map {
+		if srcMap, ok := srcValue.(map[string]interface{}); ok && !reflect.TypeOf(srcMap).AssignableTo(fieldType) {
+			target := reflect.MakeMapWithSize(fieldType, len(srcMap))
+			if err := d.decodeEntries(srcMap, target, path); err != nil {
+				return nil, err
+			}
+
+			return target.Interface(), nil
+		}
+	}
+
+	if (fieldType.Kind() == reflect.Slice && !isBytesType(fieldType)) || fieldType.Kind() == reflect.Array {
+		src := reflect.ValueOf(srcValue)
+		if (src.Kind() == reflect.Slice || src.Kind() == reflect.Array) && !src.Type().AssignableTo(fieldType) {
+			return d.decodeSlice(src, fieldType, path)
+		}
+
+		if srcMap, ok := srcValue.(map[string]interface{}); ok && d.o.indexedMaps {
+			items, ok, err := indexedItems(srcMap, d.o.indexedMapsStrict)
+			if err != nil {
+				return nil, err
+			}
+
+			if ok {
+				return d.decodeSlice(reflect.ValueOf(items), fieldType, path)
+			}
+		}
+	}
+
+	if str, ok := srcValue.(string); ok && d.parseStrings && fieldType.Kind() != reflect.Interface && baseType(fieldType).Kind() != reflect.String {
+		return parseString(str, fieldType)
+	}
+
+	if d.o.typedValues {
+		return convertTyped(srcValue, fieldType), nil
+	}
+
+	return srcValue, nil
+}
+
+// decodeSlice decodes each element of src into a new slice, or array, of
+// type t. A nil src decodes to a nil slice.
+func (d *decoder) decodeSlice(src reflect.Value, t reflect.Type, path string) (interface{}, error) {
+	if src.Kind() == reflect.Slice && src.IsNil() {
+		return reflect.Zero(t).Interface(), nil
+	}
+
+	var items reflect.Value
+	if t.Kind() == reflect.Array {
+		if src.Len() > t.Len() {
+			return nil, fmt.Errorf("%d elements do not fit in %s", src.Len(), t)
+		}
+
+		items = reflect.New(t).Elem()
+	} else {
+		items = reflect.MakeSlice(t, src.Len(), src.Len())
+	}
+
+	for i := 0; i < src.Len(); i++ {
+		itemPath := joinPath(path, strconv.Itoa(i))
+		item, err := d.decodeValue(src.Index(i).Interface(), t.Elem(), nil, itemPath)
+		if err != nil {
+			return nil, err
+		}
+
+		next, err := assignable(item, t.Elem())
+		if err != nil {
+			return nil, fmt.Errorf("index %d: %w", i, err)
+		}
+
+		items.Index(i).Set(next)
+	}
+
+	return items.Interface(), nil
+}
+
+// indexedItems orders the values of a map keyed by integer strings, such as
+// {"0": a, "1": b}, by their numeric keys. It reports false if any key is not
+// a non-negative integer. Under strict the keys must be exactly 0 to n-1.
+func indexedItems(m map[string]interface{}, strict bool) ([]interface{}, bool, error) {
+	type entry struct {
+		index int
+		value interface{}
+	}
+
+	entries := make([]entry, 0, len(m))
+	for k, v := range m {
+		i, err := strconv.Atoi(k)
+		if err != nil || i < 0 {
+			return nil, false, nil
+		}
+
+		entries = append(entries, entry{index: i, value: v})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].index < entries[j].index
+	})
+
+	items := make([]interface{}, len(entries))
+	for i, e := range entries {
+		if strict && e.index != i {
+			if i > 0 && entries[i-1].index == e.index {
+				return nil, true, fmt.Errorf("duplicate index %d", e.index)
+			}
+
+			return nil, true, fmt.Errorf("missing index %d", i)
+		}
+
+		items[i] = e.value
+	}
+
+	return items, true, nil
+}
+
+// deepCopy copies v through any nesting of map[string]interface{} and
+// []interface{}, so the result shares no maps or slices with v.
+func deepCopy(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			c[k] = deepCopy(item)
+		}
+
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, item := range v {
+			c[i] = deepCopy(item)
+		}
+
+		return c
+	}
+
+	return v
+}
+
+// dropSentinel returns m without the entries whose value is the string
+// sentinel, so they decode as if absent.
+func dropSentinel(m map[string]interface{}, sentinel string) map[string]interface{} {
+	present := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		if s, ok := v.(string); ok && s == sentinel {
+			continue
+		}
+
+		present[k] = v
+	}
+
+	return present
+}
+
+// applyScopes gathers source keys carrying a field's scope= prefix into a
+// nested map under the field's own key. Keys that directly match a mapped
+// field are never treated as scoped.
+func applyScopes(m map[string]interface{}, mappings *Info) map[string]interface{} {
+	var scoped map[string]interface{}
+	for key, flags := range mappings.flags {
+		prefix, ok := flags.Param("scope")
+		if !ok || prefix == "" {
+			continue
+		}
+
+		if scoped == nil {
+			scoped = make(map[string]interface{}, len(m))
+			for k, v := range m {
+				scoped[k] = v
+			}
+		}
+
+		inner := make(map[string]interface{})
+		if nested, ok := m[key].(map[string]interface{}); ok {
+			for k, v := range nested {
+				inner[k] = v
+			}
+		}
+
+		for k, v := range m {
+			if _, mapped := mappings.Fields[k]; mapped || len(k) <= len(prefix) || !strings.HasPrefix(k, prefix) {
+				continue
+			}
+
+			inner[k[len(prefix):]] = v
+			delete(scoped, k)
+		}
+
+		if len(inner) > 0 {
+			scoped[key] = inner
+		}
+	}
+
+	if scoped == nil {
+		return m
+	}
+
+	return scoped
+}
+
+// normalizeKey lowercases key and drops everything but letters and digits,
+// so "user_name", "user-name" and "userName" all compare equal.
+func normalizeKey(key string) string {
+	var b strings.Builder
+	for _, r := range key {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(unicode.ToLower(r))
+		}
+	}
+
+	return b.String()
+}
+
+// applyLooseKeys renames source keys that match a mapped field only after
+// normalize to that field's key. A key matching a field exactly is always
+// preferred, and when several source keys match the same field the first in
+// sorted order wins and the rest are reported. mode names the matching in
+// errors.
+func (d *decoder) applyLooseKeys(m map[string]interface{}, mappings *Info, path string, normalize func(string) string, mode string) (map[string]interface{}, error) {
+	byNorm := make(map[string]string, len(mappings.Fields))
+	for _, key := range mappings.keys(true) {
+		norm := normalize(key)
+		if other, ok := byNorm[norm]; ok {
+			return nil, fmt.Errorf("mapsmith: keys %q and %q collide under %s key matching", other, key, mode)
+		}
+
+		byNorm[norm] = key
+	}
+
+	loose := make(map[string]interface{}, len(m))
+	matched := make(map[string]string)
+	for _, k := range SortedKeys(m) {
+		key, ok := byNorm[normalize(k)]
+		if _, exact := mappings.Fields[k]; exact || !ok {
+			loose[k] = m[k]
+			continue
+		}
+
+		if _, exact := m[key]; exact {
+			loose[k] = m[k]
+			continue
+		}
+
+		if other, ok := matched[key]; ok {
+			if err := d.fail(joinPath(path, key), fmt.Errorf("source keys %q and %q both match", other, k)); err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		matched[key] = k
+		loose[key] = m[k]
+	}
+
+	return loose, nil
+}
+
+// applyGroups lifts the keys of fields declared with group= out of the
+// nested map under the group's key. Group entries that match no field are
+// left in place.
+func applyGroups(m map[string]interface{}, mappings *Info) map[string]interface{} {
+	var grouped map[string]interface{}
+	lifted := make(map[string]map[string]interface{})
+	for key, flags := range mappings.flags {
+		group, ok := flags.Param("group")
+		if !ok || group == "" {
+			continue
+		}
+
+		nested, ok := m[group].(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		value, ok := nested[key]
+		if !ok {
+			continue
+		}
+
+		if grouped == nil {
+			grouped = make(map[string]interface{}, len(m))
+			for k, v := range m {
+				grouped[k] = v
+			}
+		}
+
+		if lifted[group] == nil {
+			lifted[group] = make(map[string]interface{}, len(nested))
+			for k, v := range nested {
+				lifted[group][k] = v
+			}
+		}
+
+		grouped[key] = value
+		delete(lifted[group], key)
+	}
+
+	if grouped == nil {
+		return m
+	}
+
+	for group, rest := range lifted {
+		if _, mapped := mappings.Fields[group]; mapped {
+			continue
+		}
+
+		if len(rest) == 0 {
+			delete(grouped, group)
+		} else {
+			grouped[group] = rest
+		}
+	}
+
+	return grouped
+}
+
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+// FromMap is FromMapE with the error discarded. The same concurrency rule
+// applies.
+func FromMap(m map[string]interface{}, dest interface{}, opts ...Option) {
+	TaggedFromMap(m, dest, DefaultTag, DefaultTag, opts...)
+}
+
+// FromMapE decodes m into the struct or map dest points to, collecting every
+// field that couldn't be decoded into a DecodeError. Decoding writes to dest
+// without locking, so one destination must not be decoded into from several
+// goroutines at once, nor read while a decode is under way; decoding
+// different destinations concurrently is safe.
+func FromMapE(m map[string]interface{}, dest interface{}, opts ...Option) error {
+	return TaggedFromMapE(m, dest, DefaultTag, DefaultTag, opts...)
+}
+
+// FromOrdered decodes values into dest's mapped fields by position, in the
+// order the fields are declared, including fields promoted from inline
+// structs. The number of values must match the number of fields unless
+// WithIgnoreExtraValues is given, in which case extra values are dropped and
+// fields past the last value are treated as absent.
+func FromOrdered(values []interface{}, dest interface{}, opts ...Option) error {
+	return TaggedFromOrdered(values, dest, DefaultTag, DefaultTag, opts...)
+}
+
+func TaggedFromOrdered(values []interface{}, dest interface{}, nameTag string, filterTag string, opts ...Option) error {
+	o := newOptions(opts)
+	info, err := getMappings(dest, nameTag, filterTag, o)
+	if err != nil {
+		return err
+	}
+
+	var keys []string
+	for _, k := range info.orderedKeys() {
+		if !info.flags[k].Contains("whole") {
+			keys = append(keys, k)
+		}
+	}
+
+	if len(values) != len(keys) && !o.ignoreExtraValues {
+		return fmt.Errorf("mapsmith: got %d values for %d fields", len(values), len(keys))
+	}
+
+	m := make(map[string]interface{}, len(keys))
+	for i, k := range keys {
+		if i >= len(values) {
+			break
+		}
+
+		m[k] = values[i]
+	}
+
+	return newDecoder(nameTag, filterTag, o).decodeRoot(m, dest)
+}
+
+// FromMapChain decodes a layered source into dest: each key is looked up in
+// maps in order and the first map that holds it supplies the value, so
+// earlier maps override later ones. Required checks and defaults see a key
+// as present when any of the maps holds it. Fields tagged whole are left
+// alone, since no one map is the whole source, and PreDecoder isn't called.
+func FromMapChain(dest interface{}, maps ...map[string]interface{}) error {
+	return newDecoder(DefaultTag, DefaultTag, newOptions(nil)).decodeChain(maps, dest)
+}
+
+// FromMapWithKeyMap translates the source keys through keyMap before
+// decoding. Translated keys take precedence over untranslated source keys
+// with the same name, so an explicit keyMap entry always wins over a direct
+// tag match.
+func FromMapWithKeyMap(m map[string]interface{}, dest interface{}, keyMap map[string]string, opts ...Option) error {
+	translated := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		if _, ok := keyMap[k]; !ok {
+			translated[k] = v
+		}
+	}
+
+	for k, v := range m {
+		if mappedKey, ok := keyMap[k]; ok {
+			translated[mappedKey] = v
+		}
+	}
+
+	return FromMapE(translated, dest, opts...)
+}
+
+// FromMapWithExtras decodes m into dest and returns the top-level source
+// entries that did not match any field, whether or not dest has a catch-all,
+// sorted by key. Unknown keys inside nested structs aren't included.
+func FromMapWithExtras(m map[string]interface{}, dest interface{}, opts ...Option) ([]Pair, error) {
+	d := newDecoder(DefaultTag, DefaultTag, newOptions(opts))
+	d.extras = make(map[string]interface{})
+	err := d.decodeRoot(m, dest)
+	var extras []Pair
+	for _, k := range SortedKeys(d.extras) {
+		extras = append(extras, Pair{Key: k, Value: d.extras[k]})
+	}
+
+	return extras, err
+}
+
+func SortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+// ResetStruct zeroes every mapped field of v, including fields promoted from
+// inline structs and the catch-all, leaving unmapped fields untouched. It is
+// meant for reusing pooled decode destinations.
+func ResetStruct(v interface{}, opts ...Option) {
+	TaggedResetStruct(v, DefaultTag, DefaultTag, opts...)
+}
+
+func TaggedResetStruct(v interface{}, nameTag string, filterTag string, opts ...Option) {
+	info, err := GetMappingsE(v, nameTag, filterTag, opts...)
+	if err != nil {
+		return
+	}
+
+	for _, f := range info.Fields {
+		if r, ok := f.(*fieldHelper); ok {
+			r.reset()
+		}
+	}
+
+	if extra, ok := info.Extra.(*mapInitializerAdapter); ok {
+		if r, ok := extra.initializer.target.(*fieldHelper); ok {
+			r.reset()
+		}
+	}
+}
+
+func MapKeys(m map[string]interface{}, keyMap map[string]string) map[string]interface{} {
+	mapped := make(map[string]interface{})
+	for k, v := range m {
+		if mappedKey, ok := keyMap[k]; ok {
+			k = mappedKey
+		}
+
+		mapped[k] = v
+	}
+
+	return mapped
+}
+
+// InvertKeyMap swaps the keys and values of keyMap, failing if two keys map
+// to the same target since the inverse would be ambiguous.
+func InvertKeyMap(keyMap map[string]string) (map[string]string, error) {
+	inverse := make(map[string]string, len(keyMap))
+	keys := make([]string, 0, len(keyMap))
+	for k := range keyMap {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	for _, k := range keys {
+		target := keyMap[k]
+		if other, ok := inverse[target]; ok {
+			return nil, fmt.Errorf("mapsmith: keys %q and %q both map to %q", other, k, target)
+		}
+
+		inverse[target] = k
+	}
+
+	return inverse, nil
+}
+
+// MapKeysReverse undoes MapKeys: keys of m that are targets in keyMap are
+// renamed back to their source keys and the rest pass through unchanged.
+func MapKeysReverse(m map[string]interface{}, keyMap map[string]string) (map[string]interface{}, error) {
+	inverse, err := InvertKeyMap(keyMap)
+	if err != nil {
+		return nil, err
+	}
+
+	return MapKeys(m, inverse), nil
+}
+
+func Join(a map[string]interface{}, b map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{})
+	for k, v := range a {
+		c[k] = v
+	}
+
+	for k, v := range b {
+		c[k] = v
+	}
+
+	return c
+}
+
+// DeepJoin is Join, except that where a and b both hold a
+// map[string]interface{} under the same key the two are merged recursively
+// rather than b's replacing a's. With WithAppendSlices, two []interface{}
+// values are concatenated, a's items first. Neither input is modified.
+func DeepJoin(a map[string]interface{}, b map[string]interface{}, opts ...Option) map[string]interface{} {
+	return deepJoin(a, b, newOptions(opts))
+}
+
+func deepJoin(a map[string]interface{}, b map[string]interface{}, o *options) map[string]interface{} {
+	c := make(map[string]interface{}, len(a)+len(b))
+	for k, v := range a {
+		c[k] = v
+	}
+
+	for k, v := range b {
+		switch bv := v.(type) {
+		case map[string]interface{}:
+			if av, ok := c[k].(map[string]interface{}); ok {
+				c[k] = deepJoin(av, bv, o)
+				continue
+			}
+		case []interface{}:
+			if av, ok := c[k].([]interface{}); ok && o.appendSlices {
+				joined := make([]interface{}, 0, len(av)+len(bv))
+				c[k] = append(append(joined, av...), bv...)
+				continue
+			}
+		}
+
+		c[k] = v
+	}
+
+	return c
+}
+
+func FilterMap(m map[string]interface{}, allowedKeys []string) map[string]interface{} {
+	var ok bool
+	var v interface{}
+	r := map[string]interface{}{}
 	for _, fieldName := range allowedKeys {
 		v, ok = m[fieldName]
 		if ok {
@@ -424,3 +2728,39 @@ func FilterMap(m map[string]interface{}, allowedKeys []string) map[string]interf
 
 	return r
 }
+
+// FilterMapDeep is FilterMap for dotted paths: "server.tls.cert" keeps only
+// that leaf of the nested maps under "server", and "server.*", like
+// "server", keeps the whole subtree. Parent maps left empty are dropped.
+// Plain keys behave as they do in FilterMap.
+func FilterMapDeep(m map[string]interface{}, allowedPaths []string) map[string]interface{} {
+	paths := make([]string, len(allowedPaths))
+	for i, path := range allowedPaths {
+		paths[i] = strings.TrimSuffix(path, ".*")
+	}
+
+	return filterMask(m, newFieldMask(paths))
+}
+
+func filterMask(m map[string]interface{}, mask fieldMask) map[string]interface{} {
+	r := map[string]interface{}{}
+	for key, submask := range mask {
+		v, ok := m[key]
+		if !ok {
+			continue
+		}
+
+		if submask == nil {
+			r[key] = v
+			continue
+		}
+
+		if nested, ok := v.(map[string]interface{}); ok {
+			if filtered := filterMask(nested, submask); len(filtered) > 0 {
+				r[key] = filtered
+			}
+		}
+	}
+
+	return r
+}
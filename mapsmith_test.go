@@ -0,0 +1,1880 @@
+package mapsmith
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type basic struct {
+	Name  string `map:"name"`
+	Count int    `map:"count"`
+}
+
+func TestStructValueAndPointer(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+	}{
+		{"value", basic{Name: "a", Count: 2}},
+		{"pointer", &basic{Name: "a", Count: 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := GetMappings(tt.v, DefaultTag, DefaultTag)
+			if info == nil || len(info.Fields) != 2 {
+				t.Fatalf("GetMappings(%T) = %+v, want 2 fields", tt.v, info)
+			}
+
+			m := ToMap(tt.v)
+			want := map[string]interface{}{"name": "a", "count": 2}
+			if !reflect.DeepEqual(m, want) {
+				t.Fatalf("ToMap(%T) = %v, want %v", tt.v, m, want)
+			}
+
+			var got basic
+			FromMap(m, &got)
+			if got != (basic{Name: "a", Count: 2}) {
+				t.Fatalf("FromMap = %+v", got)
+			}
+		})
+	}
+}
+
+func TestNilStructPointer(t *testing.T) {
+	var nilPtr *basic
+	m, err := ToMapE(nilPtr)
+	if err != nil || m == nil || len(m) != 0 {
+		t.Fatalf("ToMapE(nil *basic) = %v, %v, want an empty map", m, err)
+	}
+
+	type outer struct {
+		Inner *basic `map:"inner"`
+	}
+
+	if m := ToMap(outer{}); !reflect.DeepEqual(m, map[string]interface{}{"inner": nil}) {
+		t.Fatalf("ToMap(nil nested pointer) = %v", m)
+	}
+}
+
+type embeddedBase struct {
+	ID   int    `map:"id"`
+	Name string `map:"name"`
+}
+
+type embeddingOuter struct {
+	embeddedBase
+	Age int `map:"age"`
+}
+
+type ExportedBase struct {
+	ID   int    `map:"id"`
+	Name string `map:"name"`
+}
+
+type promotingOuter struct {
+	ExportedBase
+	Age int `map:"age"`
+}
+
+type inlineOuter struct {
+	Base ExportedBase `map:",inline"`
+	Age  int          `map:"age"`
+}
+
+func TestEmbeddedStructPromotion(t *testing.T) {
+	v := promotingOuter{ExportedBase{1, "n"}, 3}
+	want := map[string]interface{}{"id": 1, "name": "n", "age": 3}
+	if m := ToMap(v); !reflect.DeepEqual(m, want) {
+		t.Fatalf("ToMap = %v, want %v", m, want)
+	}
+
+	var zero promotingOuter
+	if err := FromMapE(want, &zero); err != nil || zero != v {
+		t.Fatalf("FromMapE into zero = %+v, %v", zero, err)
+	}
+
+	set := promotingOuter{ExportedBase{9, "old"}, 0}
+	if err := FromMapE(want, &set); err != nil || set != v {
+		t.Fatalf("FromMapE into non-zero = %+v, %v", set, err)
+	}
+
+	if m := ToMap(embeddingOuter{embeddedBase{1, "n"}, 3}); !reflect.DeepEqual(m, map[string]interface{}{"age": 3}) {
+		t.Fatalf("unexported embedded struct promoted: %v", m)
+	}
+}
+
+func TestInlineValueStructDecode(t *testing.T) {
+	m := map[string]interface{}{"id": 1, "name": "n", "age": 3}
+	var got inlineOuter
+	if err := FromMapE(m, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := (inlineOuter{ExportedBase{1, "n"}, 3}); got != want {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestToMapTaggedOnly(t *testing.T) {
+	type untagged struct {
+		Tagged   string `map:"tagged"`
+		Untagged string
+	}
+
+	got := ToMapTaggedOnly(untagged{"t", "u"})
+	if want := map[string]interface{}{"tagged": "t"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("ToMapTaggedOnly = %v, want %v", got, want)
+	}
+
+	if v := (basic{"a", 1}); !reflect.DeepEqual(ToMapTaggedOnly(v), ToMap(v)) {
+		t.Fatalf("ToMapTaggedOnly = %v, differs from ToMap = %v", ToMapTaggedOnly(v), ToMap(v))
+	}
+
+	type embedded struct {
+		ExportedBase
+		Tagged string `map:"tagged"`
+	}
+
+	got = ToMapTaggedOnly(embedded{ExportedBase{1, "n"}, "t"})
+	if want := map[string]interface{}{"tagged": "t"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("ToMapTaggedOnly embedded = %v, want %v", got, want)
+	}
+}
+
+type item struct {
+	ID int `map:"id"`
+}
+
+type itemList struct {
+	Items []item   `map:"items"`
+	Names []string `map:"names"`
+}
+
+func TestStructSlices(t *testing.T) {
+	tests := []struct {
+		name string
+		v    itemList
+	}{
+		{"nil", itemList{}},
+		{"empty", itemList{Items: []item{}, Names: []string{}}},
+		{"items", itemList{Items: []item{{1}, {2}}, Names: []string{"a"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := ToMap(tt.v)
+			if items, ok := m["items"].([]map[string]interface{}); !ok || len(items) != len(tt.v.Items) {
+				t.Fatalf("ToMap items = %#v", m["items"])
+			}
+
+			var got itemList
+			if err := FromMapE(m, &got); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, tt.v) {
+				t.Fatalf("round trip = %#v, want %#v", got, tt.v)
+			}
+		})
+	}
+
+	var got itemList
+	src := map[string]interface{}{"items": []interface{}{map[string]interface{}{"id": 3}}}
+	if err := FromMapE(src, &got); err != nil || !reflect.DeepEqual(got.Items, []item{{3}}) {
+		t.Fatalf("FromMapE from []interface{} = %+v, %v", got, err)
+	}
+}
+
+type withCatchAll struct {
+	Name  string                 `map:"name"`
+	Extra map[string]interface{} `map:",inline"`
+}
+
+type patched struct {
+	Counts map[string]int `map:"m"`
+	Name   string         `map:"name"`
+}
+
+func TestPatchNilMap(t *testing.T) {
+	dest := patched{Name: "keep"}
+	if err := FromMapE(map[string]interface{}{"m": map[string]interface{}{"a": 1.0}}, &dest, WithPatch()); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := (patched{Counts: map[string]int{"a": 1}, Name: "keep"}); !reflect.DeepEqual(dest, want) {
+		t.Fatalf("patched = %+v, want %+v", dest, want)
+	}
+
+	if err := FromMapE(map[string]interface{}{"m": map[string]interface{}{"b": 2}}, &dest, WithPatch()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(dest.Counts) != 2 {
+		t.Fatalf("patch replaced the map: %v", dest.Counts)
+	}
+}
+
+type pooled struct {
+	Base     ExportedBase      `map:",inline"`
+	Age      int               `map:"age"`
+	Extra    map[string]string `map:",inline"`
+	Unmapped string
+}
+
+func TestResetStruct(t *testing.T) {
+	v := pooled{ExportedBase{1, "a"}, 2, map[string]string{"k": "v"}, "left"}
+	ResetStruct(&v)
+	if want := (pooled{Unmapped: "left"}); !reflect.DeepEqual(v, want) {
+		t.Fatalf("ResetStruct = %+v, want %+v", v, want)
+	}
+
+	e := promotingOuter{ExportedBase{1, "a"}, 2}
+	ResetStruct(&e)
+	if e != (promotingOuter{}) {
+		t.Fatalf("ResetStruct embedded = %+v", e)
+	}
+}
+
+type layered struct {
+	Host string `map:"host,required"`
+	Port int    `map:"port"`
+	User string `map:"user,required"`
+}
+
+func TestFromMapChain(t *testing.T) {
+	flags := map[string]interface{}{"host": "flag"}
+	env := map[string]interface{}{"host": "env", "port": 8080}
+	file := map[string]interface{}{"host": "file", "port": 80, "user": "root"}
+
+	var got layered
+	if err := FromMapChain(&got, flags, env, file); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := (layered{"flag", 8080, "root"}); got != want {
+		t.Fatalf("FromMapChain = %+v, want %+v", got, want)
+	}
+
+	if _, ok := flags["port"]; ok || len(flags) != 1 {
+		t.Fatalf("source map modified: %v", flags)
+	}
+
+	err := FromMapChain(&layered{}, flags, env)
+	if de, ok := err.(*DecodeError); !ok || len(de.Errors) != 1 || de.Errors[0].Key != "user" {
+		t.Fatalf("err = %v, want user missing", err)
+	}
+
+	var extra withCatchAll
+	if err := FromMapChain(&extra, map[string]interface{}{"x": 1}, map[string]interface{}{"x": 2, "y": 3, "name": "n"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if extra.Name != "n" || !reflect.DeepEqual(extra.Extra, map[string]interface{}{"x": 1, "y": 3}) {
+		t.Fatalf("FromMapChain = %+v", extra)
+	}
+
+	if err := FromMapChain(nil, file); err == nil {
+		t.Fatal("nil dest accepted")
+	}
+}
+
+func TestDerefExtras(t *testing.T) {
+	n := 5
+	s := "x"
+	src := map[string]interface{}{"name": "a", "n": &n, "s": &s, "nil": (*int)(nil)}
+
+	var plain withCatchAll
+	if err := FromMapE(src, &plain); err != nil {
+		t.Fatal(err)
+	}
+
+	if plain.Extra["n"] != &n {
+		t.Fatalf("pointer dereferenced without WithDerefExtras: %#v", plain.Extra["n"])
+	}
+
+	var deref withCatchAll
+	if err := FromMapE(src, &deref, WithDerefExtras()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{"n": 5, "s": "x", "nil": nil}
+	if !reflect.DeepEqual(deref.Extra, want) {
+		t.Fatalf("catch-all = %#v, want %#v", deref.Extra, want)
+	}
+
+	type intPointers struct {
+		Extra map[string]*int `map:",inline"`
+	}
+
+	var kept intPointers
+	if err := FromMapE(map[string]interface{}{"n": &n}, &kept, WithDerefExtras()); err != nil || kept.Extra["n"] != &n {
+		t.Fatalf("pointer element type not kept: %#v, %v", kept.Extra, err)
+	}
+}
+
+type hooked struct {
+	Name  string `map:"name,required"`
+	Port  int    `map:"port,default=80"`
+	calls []string
+}
+
+func (h *hooked) SetDefaults() {
+	h.calls = append(h.calls, "defaults")
+}
+
+func (h *hooked) PreDecode(m map[string]interface{}) {
+	h.calls = append(h.calls, "pre:"+fmt.Sprint(m["name"]))
+	m["name"] = strings.ToUpper(fmt.Sprint(m["name"]))
+}
+
+func (h *hooked) PostDecode() error {
+	h.calls = append(h.calls, fmt.Sprintf("post:%s:%d", h.Name, h.Port))
+	if h.Name == "BAD" {
+		return errors.New("bad name")
+	}
+
+	return nil
+}
+
+func (h *hooked) Validate() error {
+	h.calls = append(h.calls, "validate")
+	return nil
+}
+
+func TestDecodeHooks(t *testing.T) {
+	var h hooked
+	if err := FromMapE(map[string]interface{}{"name": "web"}, &h); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"defaults", "pre:web", "post:WEB:80", "validate"}
+	if !reflect.DeepEqual(h.calls, want) {
+		t.Fatalf("calls = %v, want %v", h.calls, want)
+	}
+
+	err := FromMapE(map[string]interface{}{"name": "bad"}, &hooked{})
+	if err == nil || !strings.Contains(err.Error(), "bad name") {
+		t.Fatalf("err = %v, want the PostDecode error", err)
+	}
+}
+
+type preset struct {
+	Host    string `map:"host,required"`
+	Port    int    `map:"port"`
+	Retries int    `map:"retries"`
+}
+
+func (p *preset) SetDefaults() {
+	p.Host = "localhost"
+	p.Port = 80
+	p.Retries = 3
+}
+
+func TestSetDefaultsOverriddenBySource(t *testing.T) {
+	// host is required but absent; SetDefaults runs before the required
+	// check, so its value satisfies it.
+	var got preset
+	if err := FromMapE(map[string]interface{}{"port": 8080}, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := (preset{"localhost", 8080, 3}); got != want {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestInterfaceFieldEncoding(t *testing.T) {
+	type holder struct {
+		V interface{} `map:"v"`
+	}
+
+	tests := []struct {
+		name string
+		v    interface{}
+		want interface{}
+	}{
+		{"nil", nil, nil},
+		{"scalar", 3, 3},
+		{"struct", basic{"a", 1}, map[string]interface{}{"name": "a", "count": 1}},
+		{"struct pointer", &basic{"a", 1}, map[string]interface{}{"name": "a", "count": 1}},
+		{"struct slice", []basic{{"a", 1}}, []map[string]interface{}{{"name": "a", "count": 1}}},
+		{"interface slice", []interface{}{basic{"a", 1}, "s"}, []interface{}{map[string]interface{}{"name": "a", "count": 1}, "s"}},
+		{"scalar slice", []int{1, 2}, []int{1, 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := ToMap(holder{tt.v})
+			if !reflect.DeepEqual(m["v"], tt.want) {
+				t.Fatalf("v = %#v, want %#v", m["v"], tt.want)
+			}
+		})
+	}
+}
+
+func TestByteString(t *testing.T) {
+	type blob struct {
+		Data []byte `map:"data,bytestring"`
+		Raw  []byte `map:"raw"`
+	}
+
+	m := ToMap(blob{Data: []byte("hi"), Raw: []byte("raw")})
+	if m["data"] != "hi" {
+		t.Fatalf("data = %#v, want a string", m["data"])
+	}
+
+	if _, ok := m["raw"].([]byte); !ok {
+		t.Fatalf("raw = %#v, want bytes", m["raw"])
+	}
+
+	var got blob
+	if err := FromMapE(m, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if string(got.Data) != "hi" || string(got.Raw) != "raw" {
+		t.Fatalf("got %q, %q", got.Data, got.Raw)
+	}
+
+	if err := FromMapE(map[string]interface{}{"data": []byte("b")}, &got); err != nil || string(got.Data) != "b" {
+		t.Fatalf("bytes into bytestring field = %q, %v", got.Data, err)
+	}
+}
+
+type withChannel struct {
+	Name string   `map:"name"`
+	C    chan int `map:"c"`
+}
+
+func TestChannelFields(t *testing.T) {
+	v := withChannel{Name: "a", C: make(chan int)}
+	m, err := ToMapE(v, WithSkipUnsupported())
+	if err != nil || !reflect.DeepEqual(m, map[string]interface{}{"name": "a"}) {
+		t.Fatalf("WithSkipUnsupported = %v, %v", m, err)
+	}
+
+	if _, err := ToMapE(v, WithStrictTypes()); err == nil || !strings.Contains(err.Error(), "unsupported kind chan") {
+		t.Fatalf("WithStrictTypes err = %v", err)
+	}
+
+	if _, err := GetMappingsE(&v, DefaultTag, DefaultTag, WithStrictTypes(), WithSkipUnsupported()); err != nil {
+		t.Fatalf("WithSkipUnsupported doesn't take precedence: %v", err)
+	}
+}
+
+type dbConfig struct {
+	Host string `map:"host"`
+	Port int    `map:"port"`
+}
+
+type scoped struct {
+	Name string   `map:"name"`
+	DB   dbConfig `map:"db,scope=db_"`
+}
+
+func TestScopedFlatKeys(t *testing.T) {
+	src := map[string]interface{}{"name": "app", "db_host": "h", "db_port": 5432}
+	var got scoped
+	if err := FromMapE(src, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := (scoped{"app", dbConfig{"h", 5432}}); got != want {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+
+	if m := ToMap(got); !reflect.DeepEqual(m, src) {
+		t.Fatalf("ToMap = %v, want %v", m, src)
+	}
+}
+
+type colliding struct {
+	Base ExportedBase `map:",inline"`
+	Name string       `map:"name"`
+}
+
+func TestConflictStrategies(t *testing.T) {
+	v := colliding{ExportedBase{1, "inner"}, "outer"}
+	tests := []struct {
+		name     string
+		strategy ConflictStrategy
+		want     map[string]interface{}
+	}{
+		{"last wins", ConflictLastWins, map[string]interface{}{"id": 1, "name": "outer"}},
+		{"first wins", ConflictFirstWins, map[string]interface{}{"id": 1, "name": "inner"}},
+		{"prefix", ConflictPrefixInline, map[string]interface{}{"id": 1, "name": "outer", "Base_name": "inner"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := ToMapE(v, WithConflictStrategy(tt.strategy))
+			if err != nil || !reflect.DeepEqual(m, tt.want) {
+				t.Fatalf("ToMapE = %v, %v, want %v", m, err, tt.want)
+			}
+		})
+	}
+
+	if _, err := GetMappingsE(&v, DefaultTag, DefaultTag, WithConflictStrategy(ConflictError)); err == nil {
+		t.Fatal("ConflictError didn't fail")
+	}
+}
+
+func TestRequiredWith(t *testing.T) {
+	type tlsConfig struct {
+		Cert string `map:"cert"`
+		Key  string `map:"key,requiredWith=cert"`
+	}
+
+	tests := []struct {
+		name string
+		src  map[string]interface{}
+		ok   bool
+	}{
+		{"neither", map[string]interface{}{}, true},
+		{"both", map[string]interface{}{"cert": "c", "key": "k"}, true},
+		{"only key", map[string]interface{}{"key": "k"}, true},
+		{"only cert", map[string]interface{}{"cert": "c"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := FromMapE(tt.src, &tlsConfig{})
+			if (err == nil) != tt.ok {
+				t.Fatalf("err = %v, want ok = %v", err, tt.ok)
+			}
+
+			if err != nil && !strings.Contains(err.Error(), `field "key": required when "cert" is present`) {
+				t.Fatalf("err = %v", err)
+			}
+		})
+	}
+}
+
+func TestOmitDefaults(t *testing.T) {
+	type server struct {
+		Host  string `map:"host,default=localhost"`
+		Port  int    `map:"port,default=80"`
+		Name  string `map:"name"`
+		Label string `map:"label,omitempty"`
+	}
+
+	m, err := ToMapE(server{Host: "localhost", Port: 8080}, WithOmitDefaults())
+	if want := map[string]interface{}{"port": 8080, "name": ""}; err != nil || !reflect.DeepEqual(m, want) {
+		t.Fatalf("ToMapE = %v, %v, want %v", m, err, want)
+	}
+
+	var got server
+	if err := FromMapE(m, &got); err != nil || got != (server{Host: "localhost", Port: 8080}) {
+		t.Fatalf("minimal output decoded to %+v, %v", got, err)
+	}
+}
+
+func TestKeepUnderOmitEmpty(t *testing.T) {
+	type counters struct {
+		Hits   int    `map:"hits,keep"`
+		Misses int    `map:"misses"`
+		Label  string `map:"label,omitempty"`
+	}
+
+	m := ToMap(counters{}, WithOmitEmpty())
+	if want := map[string]interface{}{"hits": 0}; !reflect.DeepEqual(m, want) {
+		t.Fatalf("ToMap = %v, want %v", m, want)
+	}
+}
+
+func TestStripQuotes(t *testing.T) {
+	type quoted struct {
+		S string `map:"s"`
+	}
+
+	tests := []struct {
+		in, want string
+	}{
+		{`"a"`, "a"},
+		{`'a'`, "a"},
+		{`a`, "a"},
+		{`"a'`, `"a'`},
+		{`"`, `"`},
+		{`""`, ""},
+		{`"a"b"`, `a"b`},
+	}
+
+	for _, tt := range tests {
+		var got quoted
+		if err := FromMapE(map[string]interface{}{"s": tt.in}, &got, WithStripQuotes()); err != nil {
+			t.Fatal(err)
+		}
+
+		if got.S != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.in, got.S, tt.want)
+		}
+	}
+
+	var plain quoted
+	FromMap(map[string]interface{}{"s": `"a"`}, &plain)
+	if plain.S != `"a"` {
+		t.Fatalf("quotes stripped without WithStripQuotes: %q", plain.S)
+	}
+}
+
+type golden struct {
+	Name   string                 `map:"name"`
+	Labels map[string]string      `map:"labels"`
+	Nested map[string]item        `map:"nested"`
+	Items  []dbConfig             `map:"items"`
+	Extra  map[string]interface{} `map:",inline"`
+}
+
+func TestToSortedJSONIsStable(t *testing.T) {
+	v := golden{
+		Name:   "g",
+		Labels: map[string]string{"z": "1", "a": "2", "m": "3"},
+		Nested: map[string]item{"b": {2}, "a": {1}, "c": {3}},
+		Items:  []dbConfig{{"h", 1}, {"i", 2}},
+		Extra:  map[string]interface{}{"y": map[string]interface{}{"q": 1, "b": 2}, "x": 1},
+	}
+
+	first, err := ToSortedJSON(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"items":[{"host":"h","port":1},{"host":"i","port":2}],"labels":{"a":"2","m":"3","z":"1"},` +
+		`"name":"g","nested":{"a":{"id":1},"b":{"id":2},"c":{"id":3}},"x":1,"y":{"b":2,"q":1}}`
+	if string(first) != want {
+		t.Fatalf("ToSortedJSON = %s, want %s", first, want)
+	}
+
+	for i := 0; i < 100; i++ {
+		next, err := ToSortedJSON(v)
+		if err != nil || string(next) != string(first) {
+			t.Fatalf("run %d = %s, %v", i, next, err)
+		}
+	}
+}
+
+func TestSplitStrings(t *testing.T) {
+	type list struct {
+		Tags []string `map:"tags,split=,,trim"`
+		IDs  []int    `map:"ids,split=;"`
+	}
+
+	var got list
+	if err := FromMapE(map[string]interface{}{"tags": "a, b ,c", "ids": "1;2"}, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := (list{[]string{"a", "b", "c"}, []int{1, 2}}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+
+	if m := ToMap(got); m["tags"] != "a,b,c" || m["ids"] != "1;2" {
+		t.Fatalf("ToMap = %v", m)
+	}
+}
+
+type nestedCatchAll struct {
+	Name string       `map:"name"`
+	Meta withCatchAll `map:",inline"`
+}
+
+type WithExtras struct {
+	Extra map[string]interface{} `map:",inline"`
+}
+
+type embeddedCatchAll struct {
+	WithExtras
+	Name string `map:"name"`
+}
+
+func TestHasCatchAll(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+		want bool
+	}{
+		{"direct", withCatchAll{}, true},
+		{"pointer", &withCatchAll{}, true},
+		{"nested only", nestedCatchAll{}, true},
+		{"embedded", embeddedCatchAll{}, true},
+		{"none", basic{}, false},
+		{"nil", nil, false},
+	}
+
+	for _, tt := range tests {
+		if got := HasCatchAll(tt.v); got != tt.want {
+			t.Errorf("%s: HasCatchAll = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPointerFieldsEncodeDereferenced(t *testing.T) {
+	type pointers struct {
+		S *[]string       `map:"s"`
+		M *map[string]int `map:"m"`
+		I *int            `map:"i"`
+		N *int            `map:"n"`
+	}
+
+	s := []string{"a"}
+	m := map[string]int{"k": 1}
+	i := 3
+	got := ToMap(pointers{S: &s, M: &m, I: &i})
+	want := map[string]interface{}{"s": []string{"a"}, "m": map[string]int{"k": 1}, "i": 3, "n": nil}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ToMap = %#v, want %#v", got, want)
+	}
+}
+
+func TestLooseKeyMatching(t *testing.T) {
+	type user struct {
+		UserName string `map:"user_name"`
+		ID       int    `map:"id"`
+	}
+
+	for _, key := range []string{"user_name", "user-name", "userName", "UserName", "user.name", "USER NAME"} {
+		var got user
+		if err := FromMapE(map[string]interface{}{key: "a", "id": 1}, &got, WithLooseKeyMatching()); err != nil {
+			t.Fatalf("%s: %v", key, err)
+		}
+
+		if got.UserName != "a" {
+			t.Errorf("%s: not matched", key)
+		}
+	}
+
+	var strict user
+	FromMap(map[string]interface{}{"userName": "a"}, &strict)
+	if strict.UserName != "" {
+		t.Fatal("matched loosely without WithLooseKeyMatching")
+	}
+
+	var exact user
+	if err := FromMapE(map[string]interface{}{"user_name": "exact", "userName": "loose"}, &exact, WithLooseKeyMatching()); err != nil || exact.UserName != "exact" {
+		t.Fatalf("exact key not preferred: %+v, %v", exact, err)
+	}
+
+	err := FromMapE(map[string]interface{}{"user-name": "a", "userName": "b"}, &user{}, WithLooseKeyMatching())
+	if err == nil {
+		t.Fatal("two loose matches accepted")
+	}
+}
+
+func TestFieldGroups(t *testing.T) {
+	type conn struct {
+		Name string `map:"name"`
+		Host string `map:"host,group=server"`
+		Port int    `map:"port,group=server"`
+		User string `map:"user,group=auth"`
+	}
+
+	v := conn{"c", "h", 1, "u"}
+	m := ToMap(v)
+	want := map[string]interface{}{
+		"name":   "c",
+		"server": map[string]interface{}{"host": "h", "port": 1},
+		"auth":   map[string]interface{}{"user": "u"},
+	}
+
+	if !reflect.DeepEqual(m, want) {
+		t.Fatalf("ToMap = %v, want %v", m, want)
+	}
+
+	var got conn
+	if err := FromMapE(m, &got); err != nil || got != v {
+		t.Fatalf("FromMapE = %+v, %v", got, err)
+	}
+
+	type clash struct {
+		Server string `map:"server"`
+		Host   string `map:"host,group=server"`
+	}
+
+	for i := 0; i < 20; i++ {
+		if _, err := ToMapE(clash{"s", "h"}); err == nil {
+			t.Fatal("group colliding with a field accepted")
+		}
+	}
+
+	type emptyClash struct {
+		Server string `map:"server,omitempty"`
+		Host   string `map:"host,group=server"`
+	}
+
+	if _, err := ToMapE(emptyClash{Host: "h"}); err == nil {
+		t.Fatal("group colliding with an omitted field accepted")
+	}
+}
+
+func TestAbsentSentinel(t *testing.T) {
+	type opt struct {
+		Name string `map:"name,required"`
+		Note string `map:"note"`
+	}
+
+	got := opt{Note: "kept"}
+	err := FromMapE(map[string]interface{}{"name": "n", "note": "__UNSET__"}, &got, WithAbsentSentinel("__UNSET__"))
+	if err != nil || got != (opt{"n", "kept"}) {
+		t.Fatalf("FromMapE = %+v, %v", got, err)
+	}
+
+	got = opt{}
+	err = FromMapE(map[string]interface{}{"name": "__UNSET__"}, &got, WithAbsentSentinel("__UNSET__"))
+	if !errors.Is(err, ErrRequiredMissing) {
+		t.Fatalf("sentinel for a required field: %v", err)
+	}
+}
+
+type Describer interface{ Describe() string }
+
+type label struct {
+	Text string `map:"text"`
+}
+
+func (l label) Describe() string { return l.Text }
+
+type plainLabel string
+
+func (l plainLabel) Describe() string { return string(l) }
+
+type withInterfaces struct {
+	error
+	Describer `map:"describer"`
+	Name      string `map:"name"`
+}
+
+func TestEmbeddedInterfaces(t *testing.T) {
+	tests := []struct {
+		name string
+		in   withInterfaces
+		want map[string]interface{}
+	}{
+		{"nil", withInterfaces{Name: "n"}, map[string]interface{}{"name": "n"}},
+		{"error set", withInterfaces{error: errors.New("x"), Name: "n"}, map[string]interface{}{"name": "n"}},
+		{"scalar", withInterfaces{Describer: plainLabel("p"), Name: "n"}, map[string]interface{}{"name": "n"}},
+		{"struct", withInterfaces{Describer: label{"t"}, Name: "n"}, map[string]interface{}{"name": "n", "describer": map[string]interface{}{"text": "t"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := ToMapE(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(m, tt.want) {
+				t.Fatalf("ToMapE = %#v, want %#v", m, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnwrap(t *testing.T) {
+	type wrapped struct {
+		N int `map:"n,unwrap=value"`
+	}
+
+	var got wrapped
+	if err := FromMapE(map[string]interface{}{"n": map[string]interface{}{"value": 5}}, &got); err != nil || got.N != 5 {
+		t.Fatalf("FromMapE = %+v, %v", got, err)
+	}
+
+	if err := FromMapE(map[string]interface{}{"n": 6}, &got); err != nil || got.N != 6 {
+		t.Fatalf("bare scalar: %+v, %v", got, err)
+	}
+
+	err := FromMapE(map[string]interface{}{"n": map[string]interface{}{"other": 5}}, &got)
+	if err == nil || !strings.Contains(err.Error(), `"value"`) {
+		t.Fatalf("missing unwrap key: %v", err)
+	}
+}
+
+type sparse struct {
+	A string `map:"a,omitempty"`
+	B string `map:"b,omitempty"`
+	C int    `map:"c,omitempty"`
+}
+
+func (s sparse) IsEmptyField(name string) bool {
+	switch name {
+	case "A":
+		return true
+	case "B":
+		return s.B == "-"
+	}
+
+	return false
+}
+
+func TestEmptyFieldChecker(t *testing.T) {
+	m := ToMap(sparse{A: "set", B: "-"})
+	if want := (map[string]interface{}{"c": 0}); !reflect.DeepEqual(m, want) {
+		t.Fatalf("ToMap = %v, want %v", m, want)
+	}
+
+	m = ToMap(sparse{A: "set", B: "b", C: 1})
+	if want := (map[string]interface{}{"b": "b", "c": 1}); !reflect.DeepEqual(m, want) {
+		t.Fatalf("ToMap = %v, want %v", m, want)
+	}
+
+	type noChecker struct {
+		C int `map:"c,omitempty"`
+	}
+
+	if m := ToMap(noChecker{}); len(m) != 0 {
+		t.Fatalf("ToMap = %v, want IsZero fallback to omit c", m)
+	}
+}
+
+func TestIndexedMapSlices(t *testing.T) {
+	type list struct {
+		Items []string `map:"items"`
+	}
+
+	src := map[string]interface{}{"items": map[string]interface{}{"2": "c", "0": "a", "1": "b"}}
+	var got list
+	if err := FromMapE(src, &got, WithIndexedMapSlices(true)); err != nil || !reflect.DeepEqual(got.Items, []string{"a", "b", "c"}) {
+		t.Fatalf("FromMapE = %v, %v", got.Items, err)
+	}
+
+	gappy := map[string]interface{}{"items": map[string]interface{}{"0": "a", "5": "b"}}
+	if err := FromMapE(gappy, &list{}, WithIndexedMapSlices(true)); err == nil {
+		t.Fatal("strict mode accepted a gap")
+	}
+
+	dup := map[string]interface{}{"items": map[string]interface{}{"0": "a", "1": "b", "01": "c"}}
+	if err := FromMapE(dup, &list{}, WithIndexedMapSlices(true)); err == nil {
+		t.Fatal("strict mode accepted a duplicate index")
+	}
+
+	got = list{}
+	if err := FromMapE(gappy, &got, WithIndexedMapSlices(false)); err != nil || !reflect.DeepEqual(got.Items, []string{"a", "b"}) {
+		t.Fatalf("lenient mode = %v, %v", got.Items, err)
+	}
+
+	if err := FromMapE(src, &list{}); err == nil {
+		t.Fatal("map source decoded into a slice without WithIndexedMapSlices")
+	}
+}
+
+func TestToMapWithFlag(t *testing.T) {
+	type profile struct {
+		Email    string `map:"email,public"`
+		Name     string `map:"name,omitempty,public"`
+		Password string `map:"password"`
+	}
+
+	m := ToMapWithFlag(profile{"e", "n", "p"}, "public")
+	if want := (map[string]interface{}{"email": "e", "name": "n"}); !reflect.DeepEqual(m, want) {
+		t.Fatalf("ToMapWithFlag = %v, want %v", m, want)
+	}
+
+	if m := ToMapWithFlag(profile{"e", "n", "p"}, "internal"); len(m) != 0 {
+		t.Fatalf("ToMapWithFlag = %v, want nothing", m)
+	}
+}
+
+func TestFieldPostProcess(t *testing.T) {
+	type padded struct {
+		Name string `map:"name,minlen=2"`
+		Tag  string `map:"tag"`
+		N    int    `map:"n"`
+	}
+
+	var seen []string
+	trim := WithFieldPostProcess(func(name string, set interface{}) interface{} {
+		seen = append(seen, name)
+		if s, ok := set.(string); ok {
+			return strings.TrimSpace(s)
+		}
+
+		return set
+	})
+
+	var got padded
+	if err := FromMapE(map[string]interface{}{"name": " ab ", "tag": "\tt\n", "n": 3}, &got, trim); err != nil {
+		t.Fatal(err)
+	}
+
+	if got != (padded{"ab", "t", 3}) || len(seen) != 3 {
+		t.Fatalf("got %+v after %v", got, seen)
+	}
+
+	// Validation runs after the callback, so it sees the trimmed value.
+	if err := FromMapE(map[string]interface{}{"name": " a  "}, &padded{}, trim); err == nil {
+		t.Fatal("minlen checked before post-processing")
+	}
+}
+
+type node struct {
+	Name string `map:"name"`
+	Next *node  `map:"next,omitempty"`
+}
+
+func TestMaxDepth(t *testing.T) {
+	v := node{"a", &node{"b", &node{"c", nil}}}
+
+	m := ToMap(v, WithMaxDepth(1, false))
+	want := map[string]interface{}{"name": "a", "next": map[string]interface{}{"name": "b"}}
+	if !reflect.DeepEqual(m, want) {
+		t.Fatalf("omit: ToMap = %v, want %v", m, want)
+	}
+
+	m = ToMap(v, WithMaxDepth(1, true))
+	want = map[string]interface{}{"name": "a", "next": map[string]interface{}{"name": "b", "next": "*mapsmith.node"}}
+	if !reflect.DeepEqual(m, want) {
+		t.Fatalf("placeholder: ToMap = %v, want %v", m, want)
+	}
+
+	if m := ToMap(v, WithMaxDepth(0, false)); !reflect.DeepEqual(m, ToMap(v)) {
+		t.Fatalf("zero depth limited the output: %v", m)
+	}
+}
+
+func TestFromMapTypedMap(t *testing.T) {
+	var got map[string]int
+	if err := FromMapE(map[string]interface{}{"a": 1.0, "b": 2.0}, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := (map[string]int{"a": 1, "b": 2}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	if err := FromMapE(map[string]interface{}{"a": "x"}, &got); err == nil {
+		t.Fatal("non-numeric value decoded into map[string]int")
+	}
+}
+
+func TestKeyTransformOnFallbackNames(t *testing.T) {
+	type account struct {
+		UserID    int    `map:",omitempty"`
+		FirstName string `map:"given"`
+		LastName  string `map:",omitempty"`
+	}
+
+	m := ToMap(account{1, "a", "b"}, WithKeyTransform(SnakeCase))
+	want := map[string]interface{}{"user_id": 1, "given": "a", "last_name": "b"}
+	if !reflect.DeepEqual(m, want) {
+		t.Fatalf("ToMap = %v, want %v", m, want)
+	}
+
+	var got account
+	if err := FromMapE(m, &got, WithKeyTransform(SnakeCase)); err != nil || got != (account{1, "a", "b"}) {
+		t.Fatalf("FromMapE = %+v, %v", got, err)
+	}
+}
+
+func TestWholeField(t *testing.T) {
+	type event struct {
+		Kind string                 `map:"kind"`
+		Raw  map[string]interface{} `map:"raw,whole"`
+		All  *basic                 `map:"all,whole"`
+	}
+
+	src := map[string]interface{}{"kind": "k", "name": "n", "count": 2}
+	var got event
+	if err := FromMapE(src, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Kind != "k" || !reflect.DeepEqual(got.Raw, src) {
+		t.Fatalf("got %+v", got)
+	}
+
+	got.Raw["kind"] = "changed"
+	if src["kind"] != "k" {
+		t.Fatal("whole field shares the source map")
+	}
+
+	if got.All == nil || got.All.Name != "n" || got.All.Count != 2 {
+		t.Fatalf("whole struct field = %+v", got.All)
+	}
+
+	if m := ToMap(got); !reflect.DeepEqual(m, map[string]interface{}{"kind": "k"}) {
+		t.Fatalf("ToMap = %v, want whole fields skipped", m)
+	}
+}
+
+func TestComplexFormats(t *testing.T) {
+	type signal struct {
+		Z  complex128  `map:"z"`
+		Z6 complex64   `map:"z6"`
+		P  *complex128 `map:"p,omitempty"`
+	}
+
+	p := complex(-1.5, 0)
+	v := signal{complex(1, 2), complex64(complex(3, -4)), &p}
+
+	tests := []struct {
+		format ComplexFormat
+		want   interface{}
+	}{
+		{ComplexParts, map[string]interface{}{"real": 1.0, "imag": 2.0}},
+		{ComplexString, "1+2i"},
+	}
+
+	for _, tt := range tests {
+		m := ToMap(v, WithComplexFormat(tt.format))
+		if !reflect.DeepEqual(m["z"], tt.want) {
+			t.Errorf("format %d: z = %#v, want %#v", tt.format, m["z"], tt.want)
+		}
+
+		var got signal
+		if err := FromMapE(m, &got, WithComplexFormat(tt.format)); err != nil {
+			t.Fatalf("format %d: %v", tt.format, err)
+		}
+
+		if got.Z != v.Z || got.Z6 != v.Z6 || got.P == nil || *got.P != p {
+			t.Errorf("format %d: round trip = %+v", tt.format, got)
+		}
+	}
+
+	if err := FromMapE(map[string]interface{}{"z": "nope"}, &signal{}, WithComplexFormat(ComplexString)); err == nil {
+		t.Error("invalid complex string accepted")
+	}
+}
+
+func TestKeyRewrite(t *testing.T) {
+	rewrite := WithKeyRewrite(func(key string, value interface{}) (string, bool) {
+		if key == "count" {
+			return "", false
+		}
+
+		return "x_" + key, true
+	})
+
+	m := ToMap(basic{"n", 2}, rewrite)
+	if want := (map[string]interface{}{"x_name": "n"}); !reflect.DeepEqual(m, want) {
+		t.Fatalf("ToMap = %v, want %v", m, want)
+	}
+}
+
+func TestCopyInterfaceMaps(t *testing.T) {
+	type holder struct {
+		Any interface{} `map:"any"`
+	}
+
+	inner := map[string]interface{}{"list": []interface{}{map[string]interface{}{"k": "v"}}}
+	src := map[string]interface{}{"any": map[string]interface{}{"inner": inner}}
+
+	var got holder
+	if err := FromMapE(src, &got, WithCopyInterfaceMaps()); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got.Any, src["any"]) {
+		t.Fatalf("got %v, want %v", got.Any, src["any"])
+	}
+
+	inner["list"].([]interface{})[0].(map[string]interface{})["k"] = "changed"
+	inner["added"] = true
+	copied := got.Any.(map[string]interface{})["inner"].(map[string]interface{})
+	if _, ok := copied["added"]; ok || copied["list"].([]interface{})[0].(map[string]interface{})["k"] != "v" {
+		t.Fatalf("decoded map aliases the source: %v", copied)
+	}
+
+	var shared holder
+	if err := FromMapE(src, &shared); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := shared.Any.(map[string]interface{})["inner"].(map[string]interface{})["added"]; !ok {
+		t.Fatal("without the option the source map should be stored as is")
+	}
+}
+
+func TestToKeyedMap(t *testing.T) {
+	got, err := ToKeyedMap([]basic{{"a", 1}, {"b", 2}}, "name")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{
+		"a": map[string]interface{}{"name": "a", "count": 1},
+		"b": map[string]interface{}{"name": "b", "count": 2},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ToKeyedMap = %v, want %v", got, want)
+	}
+
+	if _, err := ToKeyedMap([]basic{{"a", 1}, {"a", 2}}, "name"); err == nil {
+		t.Fatal("duplicate keys accepted")
+	}
+
+	if _, err := ToKeyedMap([]basic{{"a", 1}}, "missing"); err == nil {
+		t.Fatal("unmapped key field accepted")
+	}
+}
+
+func TestDefaults(t *testing.T) {
+	type settings struct {
+		Port    int     `map:"port,default=8080"`
+		Debug   bool    `map:"debug,default=true"`
+		Host    string  `map:"host,default=localhost"`
+		Ratio   float64 `map:"ratio,default=0.5"`
+		Retries int     `map:"retries,default=3"`
+		Workers int     `map:"workers,default=4,default-if-zero"`
+	}
+
+	var got settings
+	if err := FromMapE(map[string]interface{}{"retries": 0, "workers": 0}, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := (settings{8080, true, "localhost", 0.5, 0, 4}); got != want {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+
+	type broken struct {
+		Port int `map:"port,default=eighty"`
+	}
+
+	if err := FromMapE(map[string]interface{}{}, &broken{}); err == nil || !strings.Contains(err.Error(), "port") {
+		t.Fatalf("unparseable default: %v", err)
+	}
+}
+
+func TestToMapMask(t *testing.T) {
+	type service struct {
+		Name string   `map:"name"`
+		DB   dbConfig `map:"db"`
+		Peer dbConfig `map:"peer"`
+	}
+
+	v := service{"s", dbConfig{"h", 1}, dbConfig{"p", 2}}
+	m := ToMapMask(v, []string{"db.host", "peer"})
+	want := map[string]interface{}{
+		"db":   map[string]interface{}{"host": "h"},
+		"peer": map[string]interface{}{"host": "p", "port": 2},
+	}
+
+	if !reflect.DeepEqual(m, want) {
+		t.Fatalf("ToMapMask = %v, want %v", m, want)
+	}
+}
+
+func TestMapKeyCoercion(t *testing.T) {
+	type entry struct {
+		ID   int    `map:"id,mapkey"`
+		Name string `map:"name"`
+	}
+
+	type registry struct {
+		Entries map[string]entry `map:"entries"`
+	}
+
+	src := map[string]interface{}{"entries": map[string]interface{}{
+		"7":  map[string]interface{}{"name": "seven"},
+		"12": map[string]interface{}{"name": "twelve"},
+	}}
+
+	var got registry
+	if err := FromMapE(src, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]entry{"7": {7, "seven"}, "12": {12, "twelve"}}
+	if !reflect.DeepEqual(got.Entries, want) {
+		t.Fatalf("got %v, want %v", got.Entries, want)
+	}
+
+	bad := map[string]interface{}{"entries": map[string]interface{}{"x": map[string]interface{}{}}}
+	if err := FromMapE(bad, &registry{}); err == nil {
+		t.Fatal("non-numeric key accepted for an int mapkey field")
+	}
+}
+
+func TestStructMapValues(t *testing.T) {
+	type catalog struct {
+		ByName map[string]basic       `map:"by_name"`
+		ByPtr  map[string]*basic      `map:"by_ptr"`
+		Mixed  map[string]interface{} `map:"mixed"`
+		Extra  map[string]interface{} `map:",inline"`
+	}
+
+	v := catalog{
+		ByName: map[string]basic{"a": {"a", 1}},
+		ByPtr:  map[string]*basic{"b": {"b", 2}, "nil": nil},
+		Mixed:  map[string]interface{}{"s": basic{"s", 3}, "n": 4, "str": "x"},
+		Extra:  map[string]interface{}{"x": &basic{"x", 5}},
+	}
+
+	m := ToMap(v)
+	want := map[string]interface{}{
+		"by_name": map[string]interface{}{"a": map[string]interface{}{"name": "a", "count": 1}},
+		"by_ptr":  map[string]interface{}{"b": map[string]interface{}{"name": "b", "count": 2}, "nil": nil},
+		"mixed":   map[string]interface{}{"s": map[string]interface{}{"name": "s", "count": 3}, "n": 4, "str": "x"},
+		"x":       map[string]interface{}{"name": "x", "count": 5},
+	}
+
+	if !reflect.DeepEqual(m, want) {
+		t.Fatalf("ToMap = %#v, want %#v", m, want)
+	}
+}
+
+func TestNonFiniteFloats(t *testing.T) {
+	type reading struct {
+		NaN float64 `map:"nan"`
+		Inf float32 `map:"inf"`
+		Neg float64 `map:"neg"`
+		OK  float64 `map:"ok"`
+	}
+
+	v := reading{math.NaN(), float32(math.Inf(1)), math.Inf(-1), 1.5}
+
+	m := ToMap(v, WithNonFiniteFloats(NonFiniteNull))
+	if want := (map[string]interface{}{"nan": nil, "inf": nil, "neg": nil, "ok": 1.5}); !reflect.DeepEqual(m, want) {
+		t.Errorf("null: ToMap = %v, want %v", m, want)
+	}
+
+	m = ToMap(v, WithNonFiniteFloats(NonFiniteString))
+	if want := (map[string]interface{}{"nan": "NaN", "inf": "+Inf", "neg": "-Inf", "ok": 1.5}); !reflect.DeepEqual(m, want) {
+		t.Errorf("string: ToMap = %v, want %v", m, want)
+	}
+
+	if _, err := ToMapE(v, WithNonFiniteFloats(NonFiniteError)); !errors.Is(err, ErrNonFiniteFloat) {
+		t.Errorf("error: ToMapE = %v, want ErrNonFiniteFloat", err)
+	}
+
+	if m := ToMap(v); !math.IsNaN(m["nan"].(float64)) || !math.IsInf(m["neg"].(float64), -1) {
+		t.Errorf("raw: ToMap = %v", m)
+	}
+}
+
+func TestCaseInsensitiveKeys(t *testing.T) {
+	type user struct {
+		UserID int    `map:"userId"`
+		Name   string `map:"name"`
+	}
+
+	for _, key := range []string{"userId", "UserID", "userid", "USERID"} {
+		var got user
+		if err := FromMapE(map[string]interface{}{key: 1, "NAME": "n"}, &got, WithCaseInsensitiveKeys()); err != nil || got != (user{1, "n"}) {
+			t.Errorf("%s: got %+v, %v", key, got, err)
+		}
+	}
+
+	var plain user
+	if err := FromMapE(map[string]interface{}{"userid": 1}, &plain); err != nil || plain.UserID != 0 {
+		t.Fatalf("matched case-insensitively by default: %+v, %v", plain, err)
+	}
+
+	if err := FromMapE(map[string]interface{}{"user_id": 1}, &plain, WithCaseInsensitiveKeys()); err != nil || plain.UserID != 0 {
+		t.Fatalf("separators ignored without WithLooseKeyMatching: %+v, %v", plain, err)
+	}
+
+	// "UserID" sorts before "userid", so it wins and the other is reported.
+	var got user
+	err := FromMapE(map[string]interface{}{"userid": 2, "UserID": 1}, &got, WithCaseInsensitiveKeys())
+	var de *DecodeError
+	if !errors.As(err, &de) || len(de.Errors) != 1 || de.Errors[0].Key != "userId" || got.UserID != 1 {
+		t.Fatalf("ambiguous keys: got %+v, %v", got, err)
+	}
+}
+
+func TestOmitEmptyCollections(t *testing.T) {
+	type sparseFields struct {
+		Tags  []string          `map:"tags,omitempty"`
+		Attrs map[string]string `map:"attrs,omitempty"`
+		Ptr   *int              `map:"ptr,omitempty"`
+		Any   interface{}       `map:"any,omitempty"`
+		Fn    func()            `map:"fn,omitempty"`
+		Ch    chan int          `map:"ch,omitempty"`
+		Name  string            `map:"name,omitempty"`
+		Count int               `map:"count,omitempty"`
+	}
+
+	if m := ToMap(sparseFields{Tags: []string{}, Attrs: map[string]string{}}); len(m) != 0 {
+		t.Fatalf("ToMap = %v, want every empty field omitted", m)
+	}
+
+	zero := 0
+	m := ToMap(sparseFields{Tags: []string{"a"}, Ptr: &zero, Any: 0})
+	if len(m) != 3 || m["ptr"] != 0 || m["any"] != 0 {
+		t.Fatalf("ToMap = %v, want tags, ptr and any kept", m)
+	}
+
+	f := &fieldHelper{V: reflect.ValueOf([]string{}), F: reflect.StructField{Type: reflect.TypeOf([]string{})}}
+	if f.IsZero() {
+		t.Fatal("IsZero treats a non-nil empty slice as zero")
+	}
+}
+
+func TestRawJSONSources(t *testing.T) {
+	type lazy struct {
+		DB    dbConfig `map:"db"`
+		Items []item   `map:"items"`
+		Bytes dbConfig `map:"bytes,json"`
+		Blob  []byte   `map:"blob"`
+	}
+
+	src := map[string]interface{}{
+		"db":    json.RawMessage(`{"host":"h","port":5432}`),
+		"items": json.RawMessage(`[{"id":1},{"id":2}]`),
+		"bytes": []byte(`{"host":"b"}`),
+		"blob":  []byte(`{"raw":true}`),
+	}
+
+	var got lazy
+	if err := FromMapE(src, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := lazy{dbConfig{"h", 5432}, []item{{1}, {2}}, dbConfig{Host: "b"}, []byte(`{"raw":true}`)}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+
+	if err := FromMapE(map[string]interface{}{"db": json.RawMessage(`{bad`)}, &lazy{}); err == nil {
+		t.Fatal("invalid raw JSON accepted")
+	}
+}
+
+func TestDeepJoin(t *testing.T) {
+	a := map[string]interface{}{
+		"db":   map[string]interface{}{"host": "localhost", "port": 5432, "opts": map[string]interface{}{"ssl": false}},
+		"tags": []interface{}{"a"},
+		"mode": "dev",
+	}
+
+	b := map[string]interface{}{
+		"db":   map[string]interface{}{"port": 6543, "opts": map[string]interface{}{"timeout": 5}},
+		"tags": []interface{}{"b"},
+		"mode": map[string]interface{}{"name": "prod"},
+	}
+
+	got := DeepJoin(a, b)
+	want := map[string]interface{}{
+		"db":   map[string]interface{}{"host": "localhost", "port": 6543, "opts": map[string]interface{}{"ssl": false, "timeout": 5}},
+		"tags": []interface{}{"b"},
+		"mode": map[string]interface{}{"name": "prod"},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("DeepJoin = %v, want %v", got, want)
+	}
+
+	if a["db"].(map[string]interface{})["port"] != 5432 {
+		t.Fatal("DeepJoin modified its input")
+	}
+
+	if got := DeepJoin(a, b, WithAppendSlices()); !reflect.DeepEqual(got["tags"], []interface{}{"a", "b"}) {
+		t.Fatalf("WithAppendSlices: tags = %v", got["tags"])
+	}
+}
+
+func TestInvertKeyMap(t *testing.T) {
+	keyMap := map[string]string{"user_id": "uid", "name": "n"}
+	inverse, err := InvertKeyMap(keyMap)
+	if err != nil || !reflect.DeepEqual(inverse, map[string]string{"uid": "user_id", "n": "name"}) {
+		t.Fatalf("InvertKeyMap = %v, %v", inverse, err)
+	}
+
+	if _, err := InvertKeyMap(map[string]string{"a": "x", "b": "x"}); err == nil {
+		t.Fatal("lossy inversion accepted")
+	}
+
+	m := MapKeys(map[string]interface{}{"user_id": 1, "name": "a", "other": true}, keyMap)
+	back, err := MapKeysReverse(m, keyMap)
+	if want := (map[string]interface{}{"user_id": 1, "name": "a", "other": true}); err != nil || !reflect.DeepEqual(back, want) {
+		t.Fatalf("MapKeysReverse = %v, %v, want %v", back, err, want)
+	}
+}
+
+type money int64
+
+func (m money) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf(`"$%d.%02d"`, m/100, m%100)), nil
+}
+
+func TestJSONValueSemantics(t *testing.T) {
+	type jsonNested struct {
+		Code string `json:"code_json" map:"code"`
+	}
+
+	type invoice struct {
+		Total  money      `map:"total"`
+		Nested jsonNested `map:"nested"`
+		Count  int        `map:"count"`
+	}
+
+	v := invoice{1234, jsonNested{"x"}, 2}
+	m := ToMap(v, WithJSONValueSemantics())
+	want := map[string]interface{}{"total": "$12.34", "nested": map[string]interface{}{"code_json": "x"}, "count": 2.0}
+	if !reflect.DeepEqual(m, want) {
+		t.Fatalf("ToMap = %#v, want %#v", m, want)
+	}
+
+	if m := ToMap(v); m["total"] != money(1234) {
+		t.Fatalf("default encoding used the json.Marshaler: %#v", m["total"])
+	}
+}
+
+func TestRequiredSatisfiedByDefault(t *testing.T) {
+	type listener struct {
+		Port int    `map:"port,required,default=8080"`
+		Host string `map:"host,required,default="`
+	}
+
+	var got listener
+	err := FromMapE(map[string]interface{}{}, &got)
+	var de *DecodeError
+	if !errors.As(err, &de) || len(de.Errors) != 1 || de.Errors[0].Key != "host" || !errors.Is(err, ErrRequiredMissing) {
+		t.Fatalf("FromMapE = %v, want only host missing", err)
+	}
+
+	if got.Port != 8080 {
+		t.Fatalf("port = %d, want the default", got.Port)
+	}
+}
+
+func TestStringifiedKeys(t *testing.T) {
+	type numbered struct {
+		Name  string              `map:"name"`
+		Extra map[int]interface{} `map:",inline"`
+	}
+
+	v := numbered{"n", map[int]interface{}{1: "a", 20: true}}
+	m, err := ToMapE(v, WithStringifiedKeys())
+	if want := (map[string]interface{}{"name": "n", "1": "a", "20": true}); err != nil || !reflect.DeepEqual(m, want) {
+		t.Fatalf("ToMapE = %v, %v, want %v", m, err, want)
+	}
+
+	var got numbered
+	if err := FromMapE(m, &got, WithStringifiedKeys()); err != nil || !reflect.DeepEqual(got, v) {
+		t.Fatalf("FromMapE = %+v, %v", got, err)
+	}
+
+	err = FromMapE(map[string]interface{}{"name": "n", "x": 1}, &numbered{}, WithStringifiedKeys())
+	var de *DecodeError
+	if !errors.As(err, &de) || len(de.Errors) != 1 || de.Errors[0].Key != "x" {
+		t.Fatalf("unparseable key: %v", err)
+	}
+
+	type unsupported struct {
+		Extra map[complex128]interface{} `map:",inline"`
+	}
+
+	if err := FromMapE(map[string]interface{}{"1": 1}, &unsupported{}, WithStringifiedKeys()); err == nil {
+		t.Fatal("key kind with no string form accepted")
+	}
+}
+
+type gauge struct {
+	Name  string
+	order *[]string
+}
+
+func (g gauge) ToMapsmith() (map[string]interface{}, error) {
+	*g.order = append(*g.order, g.Name)
+	return map[string]interface{}{"name": g.Name}, nil
+}
+
+func TestDeterministicStructMapFields(t *testing.T) {
+	type gauges struct {
+		ByName map[string]gauge `map:"by_name"`
+	}
+
+	var order []string
+	v := gauges{make(map[string]gauge)}
+	for _, k := range []string{"d", "b", "e", "a", "c"} {
+		v.ByName[k] = gauge{k, &order}
+	}
+
+	for i := 0; i < 20; i++ {
+		order = nil
+		m := ToMap(v, WithDeterministicOutput())
+		if !reflect.DeepEqual(order, []string{"a", "b", "c", "d", "e"}) {
+			t.Fatalf("run %d: entries encoded in order %v", i, order)
+		}
+
+		if got := m["by_name"].(map[string]interface{})["c"]; !reflect.DeepEqual(got, map[string]interface{}{"name": "c"}) {
+			t.Fatalf("run %d: by_name.c = %v", i, got)
+		}
+	}
+}
+
+func TestSecretRedaction(t *testing.T) {
+	type login struct {
+		User     string  `map:"user"`
+		Password string  `map:"password,secret"`
+		Token    *string `map:"token,secret,omitempty"`
+	}
+
+	v := login{"u", "hunter2", nil}
+	if m := ToMap(v); !reflect.DeepEqual(m, map[string]interface{}{"user": "u", "password": "***"}) {
+		t.Errorf("ToMap = %v", m)
+	}
+
+	m := ToMap(v, WithRedactor(func(value interface{}) interface{} {
+		return fmt.Sprintf("<%d chars>", len(value.(string)))
+	}))
+	if m["password"] != "<7 chars>" {
+		t.Errorf("custom redactor: password = %v", m["password"])
+	}
+
+	m, err := ToMapUnredacted(v)
+	if err != nil || m["password"] != "hunter2" {
+		t.Errorf("ToMapUnredacted = %v, %v", m, err)
+	}
+}
+
+type point struct {
+	X, Y int
+}
+
+func (p point) ToMapsmith() (map[string]interface{}, error) {
+	return map[string]interface{}{"xy": fmt.Sprintf("%d,%d", p.X, p.Y)}, nil
+}
+
+type route struct {
+	Name  string  `map:"name"`
+	Start point   `map:"start"`
+	Stops []point `map:"stops"`
+}
+
+func (r route) ToMapsmith() (map[string]interface{}, error) {
+	if r.Name == "" {
+		return nil, errors.New("unnamed route")
+	}
+
+	return ToMapE(struct {
+		Label string  `map:"label"`
+		Start point   `map:"start"`
+		Stops []point `map:"stops"`
+	}{r.Name, r.Start, r.Stops})
+}
+
+func TestTopLevelMapMarshaler(t *testing.T) {
+	m, err := ToMapE(route{"r", point{1, 2}, []point{{3, 4}}})
+	want := map[string]interface{}{
+		"label": "r",
+		"start": map[string]interface{}{"xy": "1,2"},
+		"stops": []map[string]interface{}{{"xy": "3,4"}},
+	}
+
+	if err != nil || !reflect.DeepEqual(m, want) {
+		t.Fatalf("ToMapE = %#v, %v, want %#v", m, err, want)
+	}
+
+	if m, err := ToMapE(&route{Name: "p"}); err != nil || m["label"] != "p" {
+		t.Fatalf("pointer: ToMapE = %v, %v", m, err)
+	}
+
+	if _, err := ToMapE(route{}); err == nil || !strings.Contains(err.Error(), "unnamed route") {
+		t.Fatalf("err = %v, want the marshaler's error", err)
+	}
+}
+
+func TestAssignableInterfaceFields(t *testing.T) {
+	type sink struct {
+		W   io.Writer    `map:"w"`
+		S   fmt.Stringer `map:"s"`
+		Any interface{}  `map:"any"`
+	}
+
+	buf := &bytes.Buffer{}
+	var got sink
+	err := FromMapE(map[string]interface{}{"w": buf, "s": buf, "any": []int{1}}, &got)
+	if err != nil || got.W != buf || got.S != buf || !reflect.DeepEqual(got.Any, []int{1}) {
+		t.Fatalf("FromMapE = %+v, %v", got, err)
+	}
+
+	if err := FromMapE(map[string]interface{}{"w": "not a writer"}, &sink{}); err == nil {
+		t.Fatal("string accepted for an io.Writer field")
+	}
+}
+
+func TestCharFields(t *testing.T) {
+	type csvFormat struct {
+		Delim rune  `map:"delim,char"`
+		Quote byte  `map:"quote,char"`
+		Code  rune  `map:"code"`
+		Sep   *rune `map:"sep,char"`
+	}
+
+	sep := '→'
+	v := csvFormat{';', '"', 'A', &sep}
+	m := ToMap(v)
+	if want := (map[string]interface{}{"delim": ";", "quote": `"`, "code": int32('A'), "sep": "→"}); !reflect.DeepEqual(m, want) {
+		t.Fatalf("ToMap = %#v, want %#v", m, want)
+	}
+
+	var got csvFormat
+	if err := FromMapE(m, &got); err != nil || got.Delim != ';' || got.Quote != '"' || got.Code != 'A' || got.Sep == nil || *got.Sep != sep {
+		t.Fatalf("FromMapE = %+v, %v", got, err)
+	}
+
+	for _, src := range []map[string]interface{}{{"delim": ";;"}, {"delim": ""}, {"quote": "→"}} {
+		if err := FromMapE(src, &csvFormat{}); err == nil {
+			t.Errorf("FromMapE(%v) accepted", src)
+		}
+	}
+}
+
+func TestFromOrdered(t *testing.T) {
+	type row struct {
+		ID    int         `map:"id"`
+		Base  auditFields `map:",inline"`
+		Name  string      `map:"name"`
+		Score float32     `map:"score"`
+	}
+
+	var got row
+	if err := FromOrdered([]interface{}{1.0, "me", "n", 2.5}, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := (row{1, auditFields{"me"}, "n", 2.5}); got != want {
+		t.Fatalf("FromOrdered = %+v, want %+v", got, want)
+	}
+
+	if err := FromOrdered([]interface{}{1, "me", "n"}, &row{}); err == nil {
+		t.Fatal("too few values accepted")
+	}
+
+	if err := FromOrdered([]interface{}{1, "me", "n", 2.5, "extra"}, &row{}); err == nil {
+		t.Fatal("too many values accepted")
+	}
+
+	got = row{}
+	if err := FromOrdered([]interface{}{1, "me", "n", 2.5, "extra"}, &got, WithIgnoreExtraValues()); err != nil || got.Score != 2.5 {
+		t.Fatalf("extras not ignored: %+v, %v", got, err)
+	}
+
+	got = row{}
+	if err := FromOrdered([]interface{}{1}, &got, WithIgnoreExtraValues()); err != nil || got.ID != 1 || got.Name != "" {
+		t.Fatalf("short input: %+v, %v", got, err)
+	}
+}
+
+func TestTypeNameKey(t *testing.T) {
+	tests := []struct {
+		v    interface{}
+		opts []Option
+		want string
+	}{
+		{basic{}, nil, "basic"},
+		{&dbConfig{}, nil, "dbConfig"},
+		{dbConfig{}, []Option{WithTypeNameFunc(reflect.Type.String)}, "mapsmith.dbConfig"},
+	}
+
+	for _, tt := range tests {
+		m, err := ToMapE(tt.v, append(tt.opts, WithTypeNameKey("_type"))...)
+		if err != nil || m["_type"] != tt.want {
+			t.Errorf("%T: _type = %v, %v, want %q", tt.v, m["_type"], err, tt.want)
+		}
+	}
+
+	if m := ToMap(basic{}); m["_type"] != nil {
+		t.Errorf("type name added without WithTypeNameKey: %v", m)
+	}
+
+	if _, err := ToMapE(basic{}, WithTypeNameKey("name")); err == nil {
+		t.Error("type name key colliding with a field accepted")
+	}
+}
+
+func TestStrictTags(t *testing.T) {
+	type emptyFlag struct {
+		A string `map:"a,,omitempty"`
+	}
+
+	type unknownFlag struct {
+		A string `map:"a,omitempy"`
+	}
+
+	type knownFlags struct {
+		A string `map:"a,omitempty,default=x,split=,"`
+	}
+
+	if _, err := GetMappingsE(emptyFlag{}, DefaultTag, DefaultTag, WithStrictTags()); err == nil || !strings.Contains(err.Error(), "empty flag") {
+		t.Errorf("empty flag: err = %v", err)
+	}
+
+	if _, err := GetMappingsE(unknownFlag{}, DefaultTag, DefaultTag, WithStrictTags()); err == nil || !strings.Contains(err.Error(), `"omitempy"`) {
+		t.Errorf("unknown flag: err = %v", err)
+	}
+
+	if _, err := GetMappingsE(knownFlags{}, DefaultTag, DefaultTag, WithStrictTags()); err != nil {
+		t.Errorf("known flags: err = %v", err)
+	}
+
+	for _, v := range []interface{}{emptyFlag{"v"}, unknownFlag{"v"}} {
+		if _, err := GetMappingsE(v, DefaultTag, DefaultTag); err != nil {
+			t.Errorf("lenient %T: err = %v", v, err)
+		}
+
+		if m := ToMap(v); m["a"] != "v" {
+			t.Errorf("lenient %T: ToMap = %v", v, m)
+		}
+	}
+}
+
+func TestFromMapWithExtras(t *testing.T) {
+	type inner struct {
+		A int `map:"a"`
+	}
+
+	type outer struct {
+		Name  string `map:"name"`
+		Inner inner  `map:"inner"`
+	}
+
+	m := map[string]interface{}{
+		"name":  "n",
+		"zeta":  map[string]interface{}{"a": 1},
+		"inner": map[string]interface{}{"a": 2, "nested": true},
+		"alpha": 3,
+	}
+
+	var got outer
+	extras, err := FromMapWithExtras(m, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Pair{{"alpha", 3}, {"zeta", map[string]interface{}{"a": 1}}}
+	if !reflect.DeepEqual(extras, want) || got != (outer{"n", inner{2}}) {
+		t.Fatalf("FromMapWithExtras = %v, %+v; want %v", extras, got, want)
+	}
+
+	extras, err = FromMapWithExtras(map[string]interface{}{"name": "n"}, &got)
+	if err != nil || len(extras) != 0 {
+		t.Fatalf("FromMapWithExtras = %v, %v; want no extras", extras, err)
+	}
+}
+
+func TestFromMapWithKeyMap(t *testing.T) {
+	type user struct {
+		Name  string `map:"name"`
+		Email string `map:"email,required"`
+	}
+
+	keyMap := map[string]string{"n": "name", "mail": "email"}
+
+	var got user
+	err := FromMapWithKeyMap(map[string]interface{}{"n": "alias", "name": "direct", "mail": "e"}, &got, keyMap)
+	if err != nil || got != (user{"alias", "e"}) {
+		t.Fatalf("got %+v, %v, want the keyMap alias to beat the direct key", got, err)
+	}
+
+	got = user{}
+	if err := FromMapWithKeyMap(map[string]interface{}{"mail": "e"}, &got, keyMap); err != nil || got.Email != "e" {
+		t.Fatalf("required field from a translated key: %+v, %v", got, err)
+	}
+
+	if err := FromMapWithKeyMap(map[string]interface{}{"n": "a"}, &user{}, keyMap); !errors.Is(err, ErrRequiredMissing) {
+		t.Fatalf("err = %v, want ErrRequiredMissing", err)
+	}
+}
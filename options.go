@@ -0,0 +1,529 @@
+package mapsmith
+
+import (
+	"crypto/sha256"
+	"hash"
+	"reflect"
+)
+
+type Option func(*options)
+
+// ConflictStrategy decides which field keeps a key when a field promoted by
+// inline collides with another field.
+type ConflictStrategy int
+
+const (
+	// ConflictLastWins keeps whichever field is declared last.
+	ConflictLastWins ConflictStrategy = iota
+	// ConflictFirstWins keeps whichever field is declared first.
+	ConflictFirstWins
+	// ConflictPrefixInline moves the promoted field to "<inline>_<key>".
+	ConflictPrefixInline
+	// ConflictError makes GetMappingsE fail.
+	ConflictError
+)
+
+// ComplexFormat selects how complex64 and complex128 values are encoded.
+type ComplexFormat int
+
+const (
+	// ComplexRaw leaves complex values as they are.
+	ComplexRaw ComplexFormat = iota
+	// ComplexParts encodes a complex value as {"real": r, "imag": i}.
+	ComplexParts
+	// ComplexString encodes a complex value as a string such as "1+2i".
+	ComplexString
+)
+
+// NonFiniteMode selects how NaN and infinite floats are encoded.
+type NonFiniteMode int
+
+const (
+	// NonFiniteRaw leaves NaN and infinities as they are.
+	NonFiniteRaw NonFiniteMode = iota
+	// NonFiniteError fails the encode with ErrNonFiniteFloat.
+	NonFiniteError
+	// NonFiniteNull encodes them as nil.
+	NonFiniteNull
+	// NonFiniteString encodes them as "NaN", "+Inf" or "-Inf".
+	NonFiniteString
+)
+
+type options struct {
+	strictTags  bool
+	derefExtras bool
+	typedValues bool
+	checksumKey string
+	checksumFn  func() hash.Hash
+
+	skipUnsupported bool
+	strictTypes     bool
+	failFast        bool
+	flattenValues   bool
+	conflicts       ConflictStrategy
+	omitDefaults    bool
+	numericBools    numericBoolMode
+	boolStrings     bool
+	truthy          []string
+	falsy           []string
+	omitEmpty       bool
+	patch           bool
+	flatSep         string
+	flatIndex       string
+	stripQuotes     bool
+	deterministic   bool
+	looseKeys       bool
+	caseInsensitive bool
+	absentSentinel  *string
+
+	indexedMaps       bool
+	indexedMapsStrict bool
+
+	maxDepth         int
+	depthPlaceholder bool
+	// depth is the nesting level of the struct being encoded.
+	depth int
+
+	keyTransform func(string) string
+	complexes    ComplexFormat
+	jsonValues   bool
+	nonFinite    NonFiniteMode
+	keyRewrite   func(key string, value interface{}) (string, bool)
+
+	disallowUnknown  bool
+	rejectDuplicates bool
+	copyMaps         bool
+	tombstone        interface{}
+	appendSlices     bool
+	redactor         func(value interface{}) interface{}
+	timeLayouts      []string
+	unredacted       bool
+	stringifyKeys    bool
+
+	ignoreExtraValues bool
+
+	typeNameKey string
+	typeNameFn  func(t reflect.Type) string
+
+	converters *Converters
+
+	postProcess func(fieldName string, set interface{}) interface{}
+
+	// onlyFlag, when set, limits encoding to fields carrying that flag.
+	onlyFlag string
+	// taggedOnly stops untagged embedded structs from being promoted.
+	taggedOnly bool
+	// mask, when non-nil, limits encoding to the keys it holds.
+	mask fieldMask
+	// plans caches field layouts for a Mapper.
+	plans *planCache
+}
+
+type numericBoolMode int
+
+const (
+	numericBoolsOff numericBoolMode = iota
+	numericBoolsLoose
+	numericBoolsStrict
+)
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		checksumFn: sha256.New,
+		flatSep:    ".",
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return o
+}
+
+// WithStrictTags makes empty or unrecognized tag flags an error instead of
+// silently ignoring them.
+func WithStrictTags() Option {
+	return func(o *options) {
+		o.strictTags = true
+	}
+}
+
+// WithDerefExtras dereferences pointer values before storing them in a
+// catch-all map, unless the map's element type is itself that pointer type.
+func WithDerefExtras() Option {
+	return func(o *options) {
+		o.derefExtras = true
+	}
+}
+
+// WithStringifiedKeys lets a catch-all map have non-string keys, such as
+// map[int]interface{}. Its keys are encoded with fmt.Sprint and source keys
+// are parsed back for the map's key kind; a key that doesn't parse, or a key
+// kind with no string form, is a decode error.
+func WithStringifiedKeys() Option {
+	return func(o *options) {
+		o.stringifyKeys = true
+	}
+}
+
+// WithTypedValues wraps every scalar value as {"$type": kind, "$value": v}
+// on encode and reconstructs the exact kind on decode.
+func WithTypedValues() Option {
+	return func(o *options) {
+		o.typedValues = true
+	}
+}
+
+// WithChecksumKey stores a hex checksum of the encoded map under key. When
+// decoding, the checksum is verified and stripped before the map is applied.
+func WithChecksumKey(key string) Option {
+	return func(o *options) {
+		o.checksumKey = key
+	}
+}
+
+// WithChecksumHash sets the hash used by WithChecksumKey. SHA-256 is used by
+// default.
+func WithChecksumHash(fn func() hash.Hash) Option {
+	return func(o *options) {
+		o.checksumFn = fn
+	}
+}
+
+// WithSkipUnsupported leaves chan, func and unsafe.Pointer fields out of the
+// mapping entirely. It takes precedence over WithStrictTypes.
+func WithSkipUnsupported() Option {
+	return func(o *options) {
+		o.skipUnsupported = true
+	}
+}
+
+// WithStrictTypes makes a mapped chan, func or unsafe.Pointer field an error.
+func WithStrictTypes() Option {
+	return func(o *options) {
+		o.strictTypes = true
+	}
+}
+
+// WithFailFast stops decoding at the first field error instead of collecting
+// every error into the returned DecodeError.
+func WithFailFast(failFast bool) Option {
+	return func(o *options) {
+		o.failFast = failFast
+	}
+}
+
+// WithFlattenValues makes ToValues include nested structs under dotted keys
+// instead of skipping them.
+func WithFlattenValues() Option {
+	return func(o *options) {
+		o.flattenValues = true
+	}
+}
+
+// WithConflictStrategy sets which field keeps a key when a field promoted by
+// inline collides with another field of the same key. The default is
+// ConflictLastWins.
+func WithConflictStrategy(strategy ConflictStrategy) Option {
+	return func(o *options) {
+		o.conflicts = strategy
+	}
+}
+
+// WithOmitDefaults leaves out fields whose value equals their declared
+// default= literal. Fields without a default are unaffected.
+func WithOmitDefaults() Option {
+	return func(o *options) {
+		o.omitDefaults = true
+	}
+}
+
+// WithNumericBools lets bool fields decode from numbers or numeric strings,
+// with 0 meaning false. With strict, values other than 0 and 1 are errors;
+// otherwise any nonzero value is true.
+func WithNumericBools(strict bool) Option {
+	return func(o *options) {
+		o.numericBools = numericBoolsLoose
+		if strict {
+			o.numericBools = numericBoolsStrict
+		}
+	}
+}
+
+// WithBoolStrings lets bool fields decode from the strings in truthy and
+// falsy, compared case-insensitively. Other strings are parsed with
+// strconv.ParseBool and are an error if that fails too.
+func WithBoolStrings(truthy, falsy []string) Option {
+	return func(o *options) {
+		o.boolStrings = true
+		o.truthy = truthy
+		o.falsy = falsy
+	}
+}
+
+// WithOmitEmpty treats every field as omitempty, except fields tagged keep.
+func WithOmitEmpty() Option {
+	return func(o *options) {
+		o.omitEmpty = true
+	}
+}
+
+// WithPatch updates map and struct fields in place from map sources instead
+// of replacing them, so keys absent from the source keep their current
+// values. Nil maps and struct pointers are allocated as needed.
+func WithPatch() Option {
+	return func(o *options) {
+		o.patch = true
+	}
+}
+
+// WithFlatSeparator sets the separator ToFlatMap and FromFlatMap place
+// between nested keys. The default is ".".
+func WithFlatSeparator(sep string) Option {
+	return func(o *options) {
+		o.flatSep = sep
+	}
+}
+
+// WithFlatIndexFormat sets how a slice index is appended to its parent key,
+// e.g. "[%d]" for "a[0]". The format must contain exactly one %d; the
+// default is the separator followed by the index, as in "a.0".
+func WithFlatIndexFormat(format string) Option {
+	return func(o *options) {
+		o.flatIndex = format
+	}
+}
+
+// WithStripQuotes removes matching surrounding quotes from string source
+// values decoded into string fields.
+func WithStripQuotes() Option {
+	return func(o *options) {
+		o.stripQuotes = true
+	}
+}
+
+// WithDeterministicOutput visits fields, catch-all entries and the entries of
+// struct-valued map fields in sorted key order, so keys written by more than
+// one field always resolve the same way and encoding fails on the same entry.
+func WithDeterministicOutput() Option {
+	return func(o *options) {
+		o.deterministic = true
+	}
+}
+
+// WithLooseKeyMatching matches source keys to fields ignoring case and any
+// non-alphanumeric characters, so "user_name", "user-name" and "userName"
+// all decode into a field keyed "username". Decoding fails if two fields of
+// a struct normalize to the same key.
+func WithLooseKeyMatching() Option {
+	return func(o *options) {
+		o.looseKeys = true
+	}
+}
+
+// WithCaseInsensitiveKeys matches source keys to fields ignoring case, so
+// "UserID" and "userid" both decode into a field keyed "userId". When several
+// source keys match one field, the first in sorted order is used and the
+// error-returning functions report the others. WithLooseKeyMatching already
+// implies this.
+func WithCaseInsensitiveKeys() Option {
+	return func(o *options) {
+		o.caseInsensitive = true
+	}
+}
+
+// WithAbsentSentinel treats source values equal to sentinel as absent: the
+// field is left untouched and required checks see it as missing.
+func WithAbsentSentinel(sentinel string) Option {
+	return func(o *options) {
+		o.absentSentinel = &sentinel
+	}
+}
+
+// WithIndexedMapSlices decodes a map keyed by integer strings, such as
+// {"0": "a", "1": "b"}, into a slice field in numeric key order. With strict,
+// gaps or duplicate indexes are errors; otherwise they are collapsed.
+func WithIndexedMapSlices(strict bool) Option {
+	return func(o *options) {
+		o.indexedMaps = true
+		o.indexedMapsStrict = strict
+	}
+}
+
+// WithFieldPostProcess calls fn with each field's Go name and decoded value
+// right after the field is set, and stores whatever fn returns in its place.
+// It runs before bounds validation, so validation sees the normalized value.
+// A value the field can't hold is reported as a decode error.
+func WithFieldPostProcess(fn func(fieldName string, set interface{}) interface{}) Option {
+	return func(o *options) {
+		o.postProcess = fn
+	}
+}
+
+// WithMaxDepth limits encoding to n levels of nested structs below the value
+// passed in. Structs, and slices of structs, nested deeper are omitted, or
+// with placeholder are replaced by their type name, e.g. "*pkg.Node".
+func WithMaxDepth(n int, placeholder bool) Option {
+	return func(o *options) {
+		o.maxDepth = n
+		o.depthPlaceholder = placeholder
+	}
+}
+
+// WithKeyTransform passes every field key through fn, including the Go field
+// names used when a tag gives no name, as in `map:",omitempty"`. SnakeCase is
+// a ready-made transform.
+func WithKeyTransform(fn func(string) string) Option {
+	return func(o *options) {
+		o.keyTransform = fn
+	}
+}
+
+// WithComplexFormat encodes complex fields in format and decodes them from
+// either the parts map or the string form.
+func WithComplexFormat(format ComplexFormat) Option {
+	return func(o *options) {
+		o.complexes = format
+	}
+}
+
+// WithJSONValueSemantics encodes each field's value by marshaling it with
+// encoding/json and unmarshaling the result into a generic value, so
+// json.Marshaler implementations and json tags on nested types apply instead
+// of map tags. Numbers come out as float64. Every field pays for a marshal
+// and an unmarshal, which is several times slower than the default path.
+func WithJSONValueSemantics() Option {
+	return func(o *options) {
+		o.jsonValues = true
+	}
+}
+
+// WithKeyRewrite passes each top-level entry of an encoded map through fn
+// before any checksum is added. Returning keep as false drops the entry;
+// otherwise it is stored under newKey.
+func WithKeyRewrite(fn func(key string, value interface{}) (newKey string, keep bool)) Option {
+	return func(o *options) {
+		o.keyRewrite = fn
+	}
+}
+
+// WithDisallowUnknownKeys makes the error-returning decode functions report
+// ErrUnknownKey for every source key that matches no field of a struct
+// without a catch-all. Unknown keys are ignored by default, since sources
+// commonly carry more than one struct reads.
+func WithDisallowUnknownKeys() Option {
+	return func(o *options) {
+		o.disallowUnknown = true
+	}
+}
+
+// WithRejectDuplicateKeys makes FromPairs report ErrDuplicateKey for a key
+// that appears more than once instead of keeping its last value.
+func WithRejectDuplicateKeys() Option {
+	return func(o *options) {
+		o.rejectDuplicates = true
+	}
+}
+
+// WithCopyInterfaceMaps stores a deep copy of map sources decoded into
+// interface fields, rather than the source map itself, so later changes to
+// either side don't show through the other.
+func WithCopyInterfaceMaps() Option {
+	return func(o *options) {
+		o.copyMaps = true
+	}
+}
+
+// WithTombstone sets the value ToMapDiff writes for a key that was cleared.
+// The default is nil.
+func WithTombstone(v interface{}) Option {
+	return func(o *options) {
+		o.tombstone = v
+	}
+}
+
+// WithAppendSlices makes DeepJoin concatenate []interface{} values present
+// in both maps instead of keeping only the second.
+func WithAppendSlices() Option {
+	return func(o *options) {
+		o.appendSlices = true
+	}
+}
+
+// WithNonFiniteFloats sets how NaN and infinite float values are encoded,
+// since they cannot be marshaled to JSON as they are.
+func WithNonFiniteFloats(mode NonFiniteMode) Option {
+	return func(o *options) {
+		o.nonFinite = mode
+	}
+}
+
+// WithConverters consults c for a field's type before the converters
+// registered globally.
+func WithConverters(c *Converters) Option {
+	return func(o *options) {
+		o.converters = c
+	}
+}
+
+// WithRedactor sets the function that replaces the value of each field
+// flagged secret on encode. By default such values become "***".
+func WithRedactor(fn func(value interface{}) interface{}) Option {
+	return func(o *options) {
+		o.redactor = fn
+	}
+}
+
+func withUnredacted() Option {
+	return func(o *options) {
+		o.unredacted = true
+	}
+}
+
+func (o *options) redact(v interface{}) interface{} {
+	if o.redactor == nil {
+		return "***"
+	}
+
+	return o.redactor(v)
+}
+
+// WithTimeLayouts decodes time.Time fields from strings by trying each of
+// layouts in order and then RFC 3339, and from numbers as epoch seconds.
+func WithTimeLayouts(layouts ...string) Option {
+	return func(o *options) {
+		o.timeLayouts = layouts
+	}
+}
+
+// WithIgnoreExtraValues lets FromOrdered accept more or fewer values than
+// there are fields.
+func WithIgnoreExtraValues() Option {
+	return func(o *options) {
+		o.ignoreExtraValues = true
+	}
+}
+
+// WithTypeNameKey stores the name of the encoded struct's type under key in
+// the top-level map. The name is the type's unqualified name, e.g. "User",
+// unless changed with WithTypeNameFunc. A field mapped to key is an error.
+func WithTypeNameKey(key string) Option {
+	return func(o *options) {
+		o.typeNameKey = key
+	}
+}
+
+// WithTypeNameFunc sets how WithTypeNameKey names a type; pass
+// reflect.Type.String for package-qualified names such as "models.User".
+func WithTypeNameFunc(fn func(t reflect.Type) string) Option {
+	return func(o *options) {
+		o.typeNameFn = fn
+	}
+}
+
+func (o *options) typeName(t reflect.Type) string {
+	if o.typeNameFn == nil {
+		return t.Name()
+	}
+
+	return o.typeNameFn(t)
+}
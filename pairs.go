@@ -0,0 +1,34 @@
+package mapsmith
+
+// Pair is one entry of an ordered source, such as a decoded query string or
+// an ordered document, where keys may repeat.
+type Pair struct {
+	Key   string
+	Value interface{}
+}
+
+// FromPairs decodes pairs into dest as FromMapE decodes the map they
+// describe. A repeated key takes its last value, unless
+// WithRejectDuplicateKeys is given, in which case every repeat is reported as
+// ErrDuplicateKey.
+func FromPairs(pairs []Pair, dest interface{}, opts ...Option) error {
+	return TaggedFromPairs(pairs, dest, DefaultTag, DefaultTag, opts...)
+}
+
+func TaggedFromPairs(pairs []Pair, dest interface{}, nameTag string, filterTag string, opts ...Option) error {
+	d := newDecoder(nameTag, filterTag, newOptions(opts))
+	m := make(map[string]interface{}, len(pairs))
+	for _, p := range pairs {
+		if _, dup := m[p.Key]; dup && d.o.rejectDuplicates {
+			if err := d.fail(p.Key, ErrDuplicateKey); err != nil {
+				return newDecodeError(d.errs)
+			}
+
+			continue
+		}
+
+		m[p.Key] = p.Value
+	}
+
+	return d.decodeRoot(m, dest)
+}
@@ -0,0 +1,26 @@
+package mapsmith
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFromPairsDuplicates(t *testing.T) {
+	pairs := []Pair{{"name", "a"}, {"count", 1}, {"name", "b"}}
+
+	var got basic
+	if err := FromPairs(pairs, &got); err != nil || got != (basic{"b", 1}) {
+		t.Fatalf("lenient: got %+v, %v, want the last value", got, err)
+	}
+
+	got = basic{}
+	err := FromPairs(pairs, &got, WithRejectDuplicateKeys())
+	var de *DecodeError
+	if !errors.As(err, &de) || len(de.Errors) != 1 || de.Errors[0].Key != "name" || !errors.Is(err, ErrDuplicateKey) {
+		t.Fatalf("strict: err = %v, want ErrDuplicateKey for name", err)
+	}
+
+	if got.Count != 1 {
+		t.Fatalf("strict: other keys not decoded: %+v", got)
+	}
+}
@@ -0,0 +1,89 @@
+package mapsmith
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+type registeredType struct {
+	name string
+	typ  reflect.Type
+}
+
+var typeRegistry struct {
+	sync.RWMutex
+	types []registeredType
+}
+
+// RegisterType makes sample's type available to decodes into interface
+// fields. The type must declare a field tagged with the discriminator flag,
+// e.g. `map:"type,discriminator"`; a source map is decoded as this type when
+// its value under that field's key equals name. RegisterType panics if the
+// type has no discriminator or name is already registered to another type.
+func RegisterType(name string, sample interface{}) {
+	t := reflect.TypeOf(sample)
+	if t == nil || !isStructType(t) {
+		panic(fmt.Sprintf("mapsmith: RegisterType of non-struct type %T", sample))
+	}
+
+	if _, ok := discriminatorKey(t, DefaultTag, DefaultTag, newOptions(nil)); !ok {
+		panic(fmt.Sprintf("mapsmith: RegisterType of %s, which has no discriminator field", t))
+	}
+
+	typeRegistry.Lock()
+	defer typeRegistry.Unlock()
+	for _, rt := range typeRegistry.types {
+		if rt.name != name {
+			continue
+		}
+
+		if rt.typ != t {
+			panic(fmt.Sprintf("mapsmith: RegisterType of %s as %q, already registered to %s", t, name, rt.typ))
+		}
+
+		return
+	}
+
+	typeRegistry.types = append(typeRegistry.types, registeredType{name: name, typ: t})
+}
+
+func discriminatorKey(t reflect.Type, nameTag string, filterTag string, o *options) (string, bool) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	info, err := getMappings(reflect.New(t).Interface(), nameTag, filterTag, o)
+	if err != nil {
+		return "", false
+	}
+
+	for key, flags := range info.flags {
+		if flags.Contains("discriminator") {
+			return key, true
+		}
+	}
+
+	return "", false
+}
+
+func resolveType(m map[string]interface{}, iface reflect.Type, nameTag string, filterTag string, o *options) (reflect.Type, bool) {
+	typeRegistry.RLock()
+	defer typeRegistry.RUnlock()
+	for _, rt := range typeRegistry.types {
+		if !rt.typ.AssignableTo(iface) {
+			continue
+		}
+
+		key, ok := discriminatorKey(rt.typ, nameTag, filterTag, o)
+		if !ok {
+			continue
+		}
+
+		if v, ok := m[key]; ok && fmt.Sprint(v) == rt.name {
+			return rt.typ, true
+		}
+	}
+
+	return nil, false
+}
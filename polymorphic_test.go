@@ -0,0 +1,87 @@
+package mapsmith
+
+import "testing"
+
+type shape interface {
+	Area() float64
+}
+
+type square struct {
+	Kind string  `map:"kind,discriminator"`
+	Side float64 `map:"side"`
+}
+
+func (s square) Area() float64 { return s.Side * s.Side }
+
+type rect struct {
+	Kind string  `map:"kind,discriminator"`
+	W    float64 `map:"w"`
+	H    float64 `map:"h"`
+}
+
+func (r *rect) Area() float64 { return r.W * r.H }
+
+type drawing struct {
+	Shapes []shape `map:"shapes"`
+	Main   shape   `map:"main"`
+}
+
+func TestRegisteredTypeHierarchy(t *testing.T) {
+	RegisterType("square", square{})
+	RegisterType("rect", &rect{})
+
+	src := map[string]interface{}{
+		"main": map[string]interface{}{"kind": "rect", "w": 2.0, "h": 3.0},
+		"shapes": []interface{}{
+			map[string]interface{}{"kind": "square", "side": 2.0},
+			map[string]interface{}{"kind": "rect", "w": 1.0, "h": 5.0},
+		},
+	}
+
+	var d drawing
+	if err := FromMapE(src, &d); err != nil {
+		t.Fatal(err)
+	}
+
+	if r, ok := d.Main.(*rect); !ok || r.Area() != 6 {
+		t.Fatalf("main = %#v", d.Main)
+	}
+
+	if len(d.Shapes) != 2 || d.Shapes[0].Area() != 4 || d.Shapes[1].Area() != 5 {
+		t.Fatalf("shapes = %#v", d.Shapes)
+	}
+
+	if _, ok := d.Shapes[0].(square); !ok {
+		t.Fatalf("shapes[0] is %T, want square", d.Shapes[0])
+	}
+
+	err := FromMapE(map[string]interface{}{"main": map[string]interface{}{"kind": "circle"}}, &drawing{})
+	if err == nil {
+		t.Fatal("unregistered discriminator decoded")
+	}
+}
+
+func TestRegisterTypeRejects(t *testing.T) {
+	type plain struct {
+		Side float64 `map:"side"`
+	}
+
+	panics := func(name string, sample interface{}) (panicked bool) {
+		defer func() { panicked = recover() != nil }()
+		RegisterType(name, sample)
+		return false
+	}
+
+	if !panics("plain", plain{}) {
+		t.Error("type without a discriminator registered")
+	}
+
+	RegisterType("square", square{})
+	if !panics("square", &rect{}) {
+		t.Error("name registered to two types")
+	}
+
+	if panics("square", square{}) {
+		t.Error("registering the same type twice panicked")
+	}
+}
@@ -0,0 +1,214 @@
+package mapsmith
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TestingT is the part of testing.TB that AssertRoundTrip uses.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// AssertRoundTrip encodes v, decodes the result into a fresh value of v's
+// type and compares that with v mapped field by mapped field, failing t with
+// every key whose value didn't survive. v may be a struct or a pointer to
+// one; unexported fields aren't mapped and so aren't compared, and secret
+// fields aren't redacted. Values whose type has an Equal method, such as
+// time.Time, compare with it, and an omitempty field that is empty on both
+// sides matches. It reports whether v round-tripped.
+func AssertRoundTrip(t TestingT, v interface{}, opts ...Option) bool {
+	t.Helper()
+	rt := reflect.TypeOf(v)
+	if rt == nil || !isStructType(rt) {
+		t.Errorf("mapsmith: round trip: expected a struct, got %T", v)
+		return false
+	}
+
+	m, err := ToMapUnredacted(v, opts...)
+	if err != nil {
+		t.Errorf("mapsmith: round trip: encode: %v", err)
+		return false
+	}
+
+	decoded := reflect.New(baseType(rt))
+	if err := FromMapE(m, decoded.Interface(), opts...); err != nil {
+		t.Errorf("mapsmith: round trip: decode: %v", err)
+		return false
+	}
+
+	diffs, err := valueDiffs("", reflect.Indirect(reflect.ValueOf(v)), decoded.Elem(), newOptions(opts))
+	if err != nil {
+		t.Errorf("mapsmith: round trip: compare: %v", err)
+		return false
+	}
+
+	if len(diffs) == 0 {
+		return true
+	}
+
+	t.Errorf("mapsmith: %T did not round-trip:\n\t%s", v, strings.Join(diffs, "\n\t"))
+	return false
+}
+
+// valueDiffs describes each dotted key at which the original value a and the
+// decoded value b differ, descending into structs by their mapped fields and
+// into slices, arrays and maps that hold them, in sorted order.
+func valueDiffs(path string, a reflect.Value, b reflect.Value, o *options) ([]string, error) {
+	if !a.IsValid() || !b.IsValid() || a.Type() != b.Type() {
+		return compareValues(path, a, b), nil
+	}
+
+	switch a.Kind() {
+	case reflect.Ptr:
+		if a.IsNil() || b.IsNil() {
+			return compareValues(path, a, b), nil
+		}
+
+		return valueDiffs(path, a.Elem(), b.Elem(), o)
+	case reflect.Struct:
+		if _, ok := mapMarshaler(a.Interface()); ok {
+			break
+		}
+
+		return structDiffs(path, a, b, o)
+	case reflect.Slice, reflect.Array:
+		if !isStructType(a.Type().Elem()) {
+			break
+		}
+
+		if a.Len() != b.Len() || (a.Kind() == reflect.Slice && a.IsNil() != b.IsNil()) {
+			return compareValues(path, a, b), nil
+		}
+
+		var diffs []string
+		for i := 0; i < a.Len(); i++ {
+			d, err := valueDiffs(joinPath(path, strconv.Itoa(i)), a.Index(i), b.Index(i), o)
+			if err != nil {
+				return nil, err
+			}
+
+			diffs = append(diffs, d...)
+		}
+
+		return diffs, nil
+	case reflect.Map:
+		if !isStructType(a.Type().Elem()) || a.Type().Key().Kind() != reflect.String {
+			break
+		}
+
+		if a.Len() != b.Len() || a.IsNil() != b.IsNil() {
+			return compareValues(path, a, b), nil
+		}
+
+		keys := a.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].String() < keys[j].String()
+		})
+
+		var diffs []string
+		for _, k := range keys {
+			d, err := valueDiffs(joinPath(path, k.String()), a.MapIndex(k), b.MapIndex(k), o)
+			if err != nil {
+				return nil, err
+			}
+
+			diffs = append(diffs, d...)
+		}
+
+		return diffs, nil
+	}
+
+	return compareValues(path, a, b), nil
+}
+
+// structDiffs compares the mapped fields of structs a and b, along with the
+// entries of their catch-alls.
+func structDiffs(path string, a reflect.Value, b reflect.Value, o *options) ([]string, error) {
+	ai, err := getMappings(a.Interface(), DefaultTag, DefaultTag, o)
+	if err != nil {
+		return nil, err
+	}
+
+	bi, err := getMappings(b.Interface(), DefaultTag, DefaultTag, o)
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []string
+	for _, k := range ai.keys(true) {
+		flags := ai.flags[k]
+		if flags.Contains("whole") {
+			continue
+		}
+
+		af, bf := ai.Fields[k], bi.Fields[k]
+		if flags.Contains("omitempty") && isEmptyValue(af.Value(), fieldType(af)) && isEmptyValue(bf.Value(), fieldType(bf)) {
+			continue
+		}
+
+		d, err := valueDiffs(joinPath(path, k), reflect.ValueOf(af.Value()), reflect.ValueOf(bf.Value()), o)
+		if err != nil {
+			return nil, err
+		}
+
+		diffs = append(diffs, d...)
+	}
+
+	if ai.Extra != nil && bi.Extra != nil {
+		keys := make(map[string]bool)
+		for _, k := range ai.Extra.Keys() {
+			keys[k] = true
+		}
+
+		for _, k := range bi.Extra.Keys() {
+			keys[k] = true
+		}
+
+		sorted := make([]string, 0, len(keys))
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+
+		sort.Strings(sorted)
+		for _, k := range sorted {
+			diffs = append(diffs, compareValues(joinPath(path, k), reflect.ValueOf(ai.Extra.Index(k)), reflect.ValueOf(bi.Extra.Index(k)))...)
+		}
+	}
+
+	return diffs, nil
+}
+
+// compareValues describes a and b at path when they aren't equal.
+func compareValues(path string, a reflect.Value, b reflect.Value) []string {
+	if equalValues(a, b) {
+		return nil
+	}
+
+	return []string{fmt.Sprintf("%s: %#v before, %#v after", path, interfaceOf(a), interfaceOf(b))}
+}
+
+// equalValues compares a and b with their Equal method if their type has
+// one, as time.Time does, and deeply otherwise.
+func equalValues(a reflect.Value, b reflect.Value) bool {
+	if a.IsValid() && b.IsValid() && a.Type() == b.Type() && !(a.Kind() == reflect.Ptr && (a.IsNil() || b.IsNil())) {
+		eq := a.MethodByName("Equal")
+		if eq.IsValid() && eq.Type().NumIn() == 1 && eq.Type().In(0) == b.Type() && eq.Type().NumOut() == 1 && eq.Type().Out(0).Kind() == reflect.Bool {
+			return eq.Call([]reflect.Value{b})[0].Bool()
+		}
+	}
+
+	return reflect.DeepEqual(interfaceOf(a), interfaceOf(b))
+}
+
+func interfaceOf(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+
+	return v.Interface()
+}
@@ -0,0 +1,94 @@
+package mapsmith
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recorder is a TestingT that keeps what it was told.
+type recorder struct {
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+type roundTripped struct {
+	Name    string            `map:"name"`
+	At      time.Time         `map:"at"`
+	Items   []item            `map:"items"`
+	ByKey   map[string]item   `map:"by_key"`
+	Next    *roundTripped     `map:"next"`
+	Labels  map[string]string `map:"labels,omitempty"`
+	private int
+}
+
+type celsiusTrunc int
+
+func TestAssertRoundTrip(t *testing.T) {
+	full := roundTripped{
+		Name:    "a",
+		At:      time.Date(2024, 5, 6, 7, 8, 9, 10, time.UTC),
+		Items:   []item{{1}},
+		ByKey:   map[string]item{"x": {2}},
+		Next:    &roundTripped{Name: "b"},
+		Labels:  map[string]string{},
+		private: 3,
+	}
+
+	tests := []struct {
+		name string
+		v    interface{}
+	}{
+		{"zero", roundTripped{}},
+		{"value", full},
+		{"pointer", &full},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &recorder{}
+			if !AssertRoundTrip(r, tt.v) || len(r.errors) > 0 {
+				t.Fatalf("AssertRoundTrip failed: %v", r.errors)
+			}
+		})
+	}
+}
+
+func TestAssertRoundTripReportsLoss(t *testing.T) {
+	type defaulted struct {
+		Port int `map:"port,omitempty,default=80"`
+	}
+
+	r := &recorder{}
+	if AssertRoundTrip(r, defaulted{}) || len(r.errors) != 1 || !strings.Contains(r.errors[0], "port: 0 before, 80 after") {
+		t.Fatalf("errors = %v, want a diff at port", r.errors)
+	}
+
+	type reading struct {
+		Temp celsiusTrunc `map:"temp"`
+	}
+
+	c := NewConverters()
+	c.Register(reflect.TypeOf(celsiusTrunc(0)), func(v interface{}) interface{} {
+		return int(v.(celsiusTrunc)) / 10
+	}, func(v interface{}) (interface{}, error) {
+		return celsiusTrunc(v.(int) * 10), nil
+	})
+
+	r = &recorder{}
+	if AssertRoundTrip(r, reading{25}, WithConverters(c)) || len(r.errors) != 1 {
+		t.Fatalf("errors = %v, want a diff at temp", r.errors)
+	}
+
+	r = &recorder{}
+	if AssertRoundTrip(r, 5) || len(r.errors) != 1 {
+		t.Fatalf("non-struct accepted: %v", r.errors)
+	}
+}
@@ -0,0 +1,99 @@
+package mapsmith
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func isTimeType(t reflect.Type) bool {
+	return t == timeType || (t.Kind() == reflect.Ptr && t.Elem() == timeType)
+}
+
+func encodeEpoch(v interface{}, millis bool) interface{} {
+	var t time.Time
+	switch tv := v.(type) {
+	case time.Time:
+		t = tv
+	case *time.Time:
+		if tv == nil {
+			return nil
+		}
+
+		t = *tv
+	default:
+		return v
+	}
+
+	if millis {
+		return t.UnixNano() / int64(time.Millisecond)
+	}
+
+	return t.Unix()
+}
+
+// decodeEpoch accepts any integer or float kind, the latter covering numbers
+// decoded from JSON. Fractional seconds are kept.
+func decodeEpoch(v interface{}, fieldType reflect.Type, millis bool) (interface{}, error) {
+	if v == nil {
+		return reflect.Zero(fieldType).Interface(), nil
+	}
+
+	var sec, nsec int64
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n := rv.Convert(reflect.TypeOf(int64(0))).Int()
+		if millis {
+			sec, nsec = n/1000, (n%1000)*int64(time.Millisecond)
+		} else {
+			sec = n
+		}
+	case reflect.Float32, reflect.Float64:
+		whole, frac := math.Modf(rv.Float())
+		if millis {
+			n := int64(whole)
+			sec, nsec = n/1000, (n%1000)*int64(time.Millisecond)+int64(frac*float64(time.Millisecond))
+		} else {
+			sec, nsec = int64(whole), int64(frac*float64(time.Second))
+		}
+	default:
+		return nil, fmt.Errorf("cannot decode epoch time from %T", v)
+	}
+
+	return timeValue(time.Unix(sec, nsec), fieldType), nil
+}
+
+// decodeLayouts parses a string by each of layouts in turn and then as RFC
+// 3339, keeping the first success. Numbers are read as epoch seconds.
+func decodeLayouts(v interface{}, fieldType reflect.Type, layouts []string) (interface{}, error) {
+	str, ok := v.(string)
+	if !ok {
+		if v != nil && reflect.TypeOf(v).AssignableTo(fieldType) {
+			return v, nil
+		}
+
+		return decodeEpoch(v, fieldType, false)
+	}
+
+	tried := append(append([]string(nil), layouts...), time.RFC3339)
+	for _, layout := range tried {
+		if t, err := time.Parse(layout, str); err == nil {
+			return timeValue(t, fieldType), nil
+		}
+	}
+
+	return nil, fmt.Errorf("cannot parse %q as time using layouts %q", str, tried)
+}
+
+func timeValue(t time.Time, fieldType reflect.Type) interface{} {
+	if fieldType.Kind() == reflect.Ptr {
+		return &t
+	}
+
+	return t
+}
@@ -0,0 +1,70 @@
+package mapsmith
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+type epochs struct {
+	Sec    time.Time  `map:"sec,unix"`
+	Milli  time.Time  `map:"milli,unixmilli"`
+	MaybeS *time.Time `map:"maybe,unix"`
+}
+
+func TestEpochTimes(t *testing.T) {
+	at := time.Unix(1700000000, 123000000)
+	m := ToMap(epochs{Sec: at, Milli: at, MaybeS: &at})
+	if m["sec"] != int64(1700000000) || m["milli"] != int64(1700000000123) || m["maybe"] != int64(1700000000) {
+		t.Fatalf("ToMap = %v", m)
+	}
+
+	var got epochs
+	if err := FromMapE(m, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Sec.Unix() != 1700000000 || !got.Milli.Equal(at) || got.MaybeS == nil || got.MaybeS.Unix() != 1700000000 {
+		t.Fatalf("from ints = %+v", got)
+	}
+
+	// JSON numbers arrive as float64; fractional seconds are kept.
+	var fromJSON epochs
+	if err := FromMapE(map[string]interface{}{"sec": 1700000000.5, "milli": 1700000000123.0}, &fromJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	if fromJSON.Sec.UnixNano() != 1700000000500000000 || !fromJSON.Milli.Equal(at) {
+		t.Fatalf("from floats = %+v", fromJSON)
+	}
+
+	if err := FromMapE(map[string]interface{}{"sec": "soon"}, &epochs{}); err == nil {
+		t.Fatal("string epoch decoded")
+	}
+}
+
+func TestTimeLayoutsOrder(t *testing.T) {
+	layouts := WithTimeLayouts("2006-01-02", "01/02/2006", "Jan 2 2006 15:04")
+
+	var got timed
+	if err := FromMapE(map[string]interface{}{"at": "Mar 4 2021 10:30"}, &got, layouts); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := time.Date(2021, 3, 4, 10, 30, 0, 0, time.UTC); !got.At.Equal(want) {
+		t.Fatalf("third layout: at = %v, want %v", got.At, want)
+	}
+
+	if err := FromMapE(map[string]interface{}{"at": "2021-03-04T10:30:00Z"}, &got, layouts); err != nil || got.At.Hour() != 10 {
+		t.Fatalf("RFC 3339 fallback: %v, %v", got.At, err)
+	}
+
+	if err := FromMapE(map[string]interface{}{"at": 60}, &got, layouts); err != nil || got.At.Unix() != 60 {
+		t.Fatalf("epoch: %v, %v", got.At, err)
+	}
+
+	err := FromMapE(map[string]interface{}{"at": "soon"}, &got, layouts)
+	if err == nil || !strings.Contains(err.Error(), "01/02/2006") || !strings.Contains(err.Error(), time.RFC3339) {
+		t.Fatalf("err = %v, want every attempted layout listed", err)
+	}
+}
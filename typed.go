@@ -0,0 +1,98 @@
+package mapsmith
+
+import (
+	"reflect"
+)
+
+const (
+	typedTypeKey  = "$type"
+	typedValueKey = "$value"
+)
+
+var typedKinds = map[string]reflect.Type{}
+
+func init() {
+	samples := []interface{}{
+		false, "",
+		int(0), int8(0), int16(0), int32(0), int64(0),
+		uint(0), uint8(0), uint16(0), uint32(0), uint64(0), uintptr(0),
+		float32(0), float64(0),
+		complex64(0), complex128(0),
+	}
+
+	for _, sample := range samples {
+		t := reflect.TypeOf(sample)
+		typedKinds[t.Kind().String()] = t
+	}
+}
+
+func isNumberKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+
+	return false
+}
+
+func wrapTyped(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return v
+	}
+
+	name := rv.Kind().String()
+	t, ok := typedKinds[name]
+	if !ok {
+		return v
+	}
+
+	return map[string]interface{}{
+		typedTypeKey:  name,
+		typedValueKey: rv.Convert(t).Interface(),
+	}
+}
+
+func unwrapTyped(v interface{}) interface{} {
+	m, ok := v.(map[string]interface{})
+	if !ok || len(m) != 2 {
+		return v
+	}
+
+	name, ok := m[typedTypeKey].(string)
+	if !ok {
+		return v
+	}
+
+	value, ok := m[typedValueKey]
+	if !ok {
+		return v
+	}
+
+	t, ok := typedKinds[name]
+	if !ok {
+		return v
+	}
+
+	rv := reflect.ValueOf(value)
+	if !rv.IsValid() {
+		return v
+	}
+
+	if rv.Kind() == t.Kind() || (isNumberKind(rv.Kind()) && isNumberKind(t.Kind())) {
+		return rv.Convert(t).Interface()
+	}
+
+	return v
+}
+
+func convertTyped(v interface{}, t reflect.Type) interface{} {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() || rv.Type() == t || rv.Kind() != t.Kind() || !rv.Type().ConvertibleTo(t) {
+		return v
+	}
+
+	return rv.Convert(t).Interface()
+}
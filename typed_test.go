@@ -0,0 +1,43 @@
+package mapsmith
+
+import (
+	"reflect"
+	"testing"
+)
+
+type narrow struct {
+	I8  int8        `map:"i8"`
+	I16 int16       `map:"i16"`
+	U8  uint8       `map:"u8"`
+	U32 uint32      `map:"u32"`
+	F32 float32     `map:"f32"`
+	Any interface{} `map:"any"`
+}
+
+func TestTypedValuesReconstructNarrowInts(t *testing.T) {
+	v := narrow{I8: -8, I16: 1600, U8: 200, U32: 1 << 31, F32: 1.5, Any: int16(7)}
+	m := ToMap(v, WithTypedValues())
+	if want := map[string]interface{}{"$type": "int8", "$value": int8(-8)}; !reflect.DeepEqual(m["i8"], want) {
+		t.Fatalf("i8 = %#v, want %#v", m["i8"], want)
+	}
+
+	// Simulate a JSON round trip, which turns every number into a float64.
+	for k, wrapped := range m {
+		w := wrapped.(map[string]interface{})
+		w["$value"] = reflect.ValueOf(w["$value"]).Convert(reflect.TypeOf(float64(0))).Interface()
+		m[k] = w
+	}
+
+	var got narrow
+	if err := FromMapE(m, &got, WithTypedValues()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got != v {
+		t.Fatalf("got %#v, want %#v", got, v)
+	}
+
+	if _, ok := got.Any.(int16); !ok {
+		t.Fatalf("interface field holds %T, want int16", got.Any)
+	}
+}
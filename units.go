@@ -0,0 +1,109 @@
+package mapsmith
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var unitParsers = struct {
+	sync.RWMutex
+	parsers map[reflect.Type]func(string) (interface{}, error)
+}{
+	parsers: map[reflect.Type]func(string) (interface{}, error){
+		durationType: ParseDurationUnit,
+	},
+}
+
+// RegisterUnitParser makes string sources decoded into fields of type t, or
+// pointers to it, go through parse. Parsers for time.Duration ship
+// registered; ParseByteSize can be registered for byte-count types.
+func RegisterUnitParser(t reflect.Type, parse func(string) (interface{}, error)) {
+	unitParsers.Lock()
+	defer unitParsers.Unlock()
+	unitParsers.parsers[t] = parse
+}
+
+func lookupUnitParser(t reflect.Type) (func(string) (interface{}, error), bool) {
+	unitParsers.RLock()
+	defer unitParsers.RUnlock()
+	parse, ok := unitParsers.parsers[t]
+	return parse, ok
+}
+
+// ParseDurationUnit parses s with time.ParseDuration, e.g. "2h30m".
+func ParseDurationUnit(s string) (interface{}, error) {
+	return time.ParseDuration(strings.TrimSpace(s))
+}
+
+var byteUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"kb":  1e3,
+	"mb":  1e6,
+	"gb":  1e9,
+	"tb":  1e12,
+	"pb":  1e15,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+	"pib": 1 << 50,
+}
+
+// ParseByteSize parses a byte count such as "10MB", "1.5 GiB" or "512" into
+// an int64. Units are case-insensitive; KB, MB, ... are powers of 1000 and
+// KiB, MiB, ... powers of 1024.
+func ParseByteSize(s string) (interface{}, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+
+	number, unit := s, ""
+	if i >= 0 {
+		number, unit = s[:i], strings.ToLower(strings.TrimSpace(s[i:]))
+	}
+
+	n, err := strconv.ParseFloat(number, 64)
+	multiplier, ok := byteUnits[unit]
+	if err != nil || !ok {
+		return nil, fmt.Errorf("invalid byte size %q", s)
+	}
+
+	size := n * multiplier
+	if size > math.MaxInt64 {
+		return nil, fmt.Errorf("byte size %q overflows int64", s)
+	}
+
+	return int64(size), nil
+}
+
+func parseUnit(s string, t reflect.Type) (interface{}, bool, error) {
+	parse, ok := lookupUnitParser(baseType(t))
+	if !ok {
+		return nil, false, nil
+	}
+
+	v, err := parse(s)
+	if err != nil {
+		return nil, true, err
+	}
+
+	next, err := assignable(v, baseType(t))
+	if err != nil {
+		return nil, true, err
+	}
+
+	if t.Kind() == reflect.Ptr {
+		p := reflect.New(t.Elem())
+		p.Elem().Set(next)
+		return p.Interface(), true, nil
+	}
+
+	return next.Interface(), true, nil
+}
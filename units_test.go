@@ -0,0 +1,37 @@
+package mapsmith
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type byteCount int64
+
+type limits struct {
+	Max     byteCount     `map:"max"`
+	Timeout time.Duration `map:"timeout"`
+	Buf     *byteCount    `map:"buf"`
+}
+
+func TestUnitParsers(t *testing.T) {
+	RegisterUnitParser(reflect.TypeOf(byteCount(0)), ParseByteSize)
+
+	var got limits
+	err := FromMapE(map[string]interface{}{"max": "10MB", "timeout": "2h30m", "buf": "4 KiB"}, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Max != 10e6 || got.Timeout != 150*time.Minute || got.Buf == nil || *got.Buf != 4096 {
+		t.Fatalf("got %+v", got)
+	}
+
+	if err := FromMapE(map[string]interface{}{"max": "10XB"}, &limits{}); err == nil {
+		t.Fatal("unknown unit accepted")
+	}
+
+	if err := FromMapE(map[string]interface{}{"max": 5}, &got); err != nil || got.Max != 5 {
+		t.Fatalf("numeric source = %v, %v", got.Max, err)
+	}
+}
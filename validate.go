@@ -0,0 +1,136 @@
+package mapsmith
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// validateBounds checks v against the min=, max=, minlen= and maxlen= flags.
+// min and max apply to numbers, minlen and maxlen to strings, slices, arrays
+// and maps; a nil pointer is not checked.
+func validateBounds(v interface{}, flags stringSet) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+
+		rv = rv.Elem()
+	}
+
+	if !rv.IsValid() {
+		return nil
+	}
+
+	if isNumberKind(rv.Kind()) {
+		n := numberValue(rv)
+		if limit, ok, err := floatParam(flags, "min"); err != nil {
+			return err
+		} else if ok && n < limit {
+			return fmt.Errorf("value %v is less than minimum %v", rv.Interface(), limit)
+		}
+
+		if limit, ok, err := floatParam(flags, "max"); err != nil {
+			return err
+		} else if ok && n > limit {
+			return fmt.Errorf("value %v is greater than maximum %v", rv.Interface(), limit)
+		}
+	}
+
+	switch rv.Kind() {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		n := rv.Len()
+		if limit, ok, err := intParam(flags, "minlen"); err != nil {
+			return err
+		} else if ok && n < limit {
+			return fmt.Errorf("length %d is less than minimum %d", n, limit)
+		}
+
+		if limit, ok, err := intParam(flags, "maxlen"); err != nil {
+			return err
+		} else if ok && n > limit {
+			return fmt.Errorf("length %d is greater than maximum %d", n, limit)
+		}
+	}
+
+	return nil
+}
+
+func hasBounds(flags stringSet) bool {
+	for _, name := range []string{"min", "max", "minlen", "maxlen"} {
+		if _, ok := flags.Param(name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func numberValue(rv reflect.Value) float64 {
+	switch rv.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	}
+
+	return float64(rv.Int())
+}
+
+func floatParam(flags stringSet, name string) (float64, bool, error) {
+	s, ok := flags.Param(name)
+	if !ok {
+		return 0, false, nil
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid %s bound %q", name, s)
+	}
+
+	return f, true, nil
+}
+
+func intParam(flags stringSet, name string) (int, bool, error) {
+	s, ok := flags.Param(name)
+	if !ok {
+		return 0, false, nil
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid %s bound %q", name, s)
+	}
+
+	return n, true, nil
+}
+
+// ValidateExact checks, without decoding, that every key of m is mapped by
+// v's struct and that every required key is present. A catch-all does not
+// make unmapped keys acceptable.
+func ValidateExact(m map[string]interface{}, v interface{}, opts ...Option) error {
+	info, err := GetMappingsE(v, DefaultTag, DefaultTag, opts...)
+	if err != nil {
+		return err
+	}
+
+	e := &SchemaError{}
+	for _, key := range SortedKeys(m) {
+		if _, ok := info.Fields[key]; !ok {
+			e.Unknown = append(e.Unknown, key)
+		}
+	}
+
+	for _, key := range info.keys(true) {
+		if _, ok := m[key]; !ok && info.flags[key].Contains("required") {
+			e.Missing = append(e.Missing, key)
+		}
+	}
+
+	if len(e.Unknown) == 0 && len(e.Missing) == 0 {
+		return nil
+	}
+
+	return e
+}
@@ -0,0 +1,113 @@
+package mapsmith
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type bounded struct {
+	Port  int      `map:"port,min=1,max=65535"`
+	Ratio float64  `map:"ratio,min=0,max=1"`
+	Name  string   `map:"name,minlen=2,maxlen=4"`
+	Tags  []string `map:"tags,maxlen=2"`
+}
+
+func TestBounds(t *testing.T) {
+	tests := []struct {
+		name string
+		src  map[string]interface{}
+		bad  []string
+	}{
+		{"at lower bounds", map[string]interface{}{"port": 1, "ratio": 0.0, "name": "ab", "tags": []string{}}, nil},
+		{"at upper bounds", map[string]interface{}{"port": 65535, "ratio": 1.0, "name": "abcd", "tags": []string{"a", "b"}}, nil},
+		{"below", map[string]interface{}{"port": 0, "ratio": -0.1, "name": "a"}, []string{"name", "port", "ratio"}},
+		{"above", map[string]interface{}{"port": 65536, "ratio": 1.5, "name": "abcde", "tags": []string{"a", "b", "c"}}, []string{"name", "port", "ratio", "tags"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := FromMapE(tt.src, &bounded{})
+			if tt.bad == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				return
+			}
+
+			var de *DecodeError
+			if !errors.As(err, &de) || len(de.Errors) != len(tt.bad) {
+				t.Fatalf("err = %v, want errors for %v", err, tt.bad)
+			}
+
+			for i, fe := range de.Errors {
+				if fe.Key != tt.bad[i] {
+					t.Fatalf("error %d is for %q, want %q", i, fe.Key, tt.bad[i])
+				}
+			}
+		})
+	}
+}
+
+func TestValidateExact(t *testing.T) {
+	type schema struct {
+		Name  string `map:"name,required"`
+		Email string `map:"email,required"`
+		Bio   string `map:"bio"`
+	}
+
+	err := ValidateExact(map[string]interface{}{"name": "n", "extra": 1}, schema{})
+	var se *SchemaError
+	if !errors.As(err, &se) {
+		t.Fatalf("ValidateExact = %v, want a *SchemaError", err)
+	}
+
+	if !reflect.DeepEqual(se.Unknown, []string{"extra"}) || !reflect.DeepEqual(se.Missing, []string{"email"}) {
+		t.Fatalf("SchemaError = %+v", se)
+	}
+
+	if err := ValidateExact(map[string]interface{}{"name": "n", "email": "e"}, schema{}); err != nil {
+		t.Fatalf("ValidateExact on a matching map = %v", err)
+	}
+}
+
+var errBadPort = errors.New("port out of range")
+
+type checkedPort struct {
+	N int `map:"n"`
+}
+
+func (p checkedPort) Validate() error {
+	if p.N > 65535 {
+		return errBadPort
+	}
+
+	return nil
+}
+
+func TestNestedValidate(t *testing.T) {
+	type listener struct {
+		Name string        `map:"name"`
+		Port checkedPort   `map:"port"`
+		Alts []checkedPort `map:"alts"`
+	}
+
+	src := map[string]interface{}{"name": "l", "port": map[string]interface{}{"n": 70000}}
+	err := FromMapE(src, &listener{})
+	var de *DecodeError
+	if !errors.As(err, &de) || len(de.Errors) != 1 || de.Errors[0].Key != "port" || !errors.Is(err, errBadPort) {
+		t.Fatalf("err = %v, want errBadPort at port", err)
+	}
+
+	src["port"] = map[string]interface{}{"n": 80}
+	src["alts"] = []interface{}{map[string]interface{}{"n": 1}, map[string]interface{}{"n": 70000}}
+	if err := FromMapE(src, &listener{}); !errors.Is(err, errBadPort) || !strings.Contains(err.Error(), "alts") {
+		t.Fatalf("slice element: err = %v", err)
+	}
+
+	if err := FromMapE(map[string]interface{}{"name": "l"}, &listener{}); err != nil {
+		t.Fatalf("valid input: %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+package mapsmith
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+func ToValues(v interface{}, opts ...Option) url.Values {
+	return TaggedToValues(v, DefaultTag, DefaultTag, opts...)
+}
+
+// TaggedToValues encodes v and stringifies each scalar entry. Slices become
+// repeated values; nested structs are skipped unless WithFlattenValues is
+// given, in which case their fields are added under dotted keys.
+func TaggedToValues(v interface{}, nameTag string, filterTag string, opts ...Option) url.Values {
+	o := newOptions(opts)
+	vals := url.Values{}
+	m, err := toMap(v, nameTag, filterTag, o)
+	if err != nil {
+		return vals
+	}
+
+	addValues(vals, "", m, o.flattenValues)
+	return vals
+}
+
+func addValues(vals url.Values, prefix string, m map[string]interface{}, flatten bool) {
+	for k, v := range m {
+		key := joinPath(prefix, k)
+		if nested, ok := v.(map[string]interface{}); ok {
+			if flatten {
+				addValues(vals, key, nested, flatten)
+			}
+
+			continue
+		}
+
+		rv := reflect.Indirect(reflect.ValueOf(v))
+		if (rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array) && !isBytesType(rv.Type()) {
+			for i := 0; i < rv.Len(); i++ {
+				if s, ok := valueString(rv.Index(i)); ok {
+					vals.Add(key, s)
+				}
+			}
+
+			continue
+		}
+
+		if s, ok := valueString(rv); ok {
+			vals.Add(key, s)
+		}
+	}
+}
+
+func valueString(rv reflect.Value) (string, bool) {
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return "", false
+		}
+
+		rv = rv.Elem()
+	}
+
+	switch rv.Kind() {
+	case reflect.Invalid, reflect.Map, reflect.Struct, reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return "", false
+	case reflect.Slice, reflect.Array:
+		if !isBytesType(rv.Type()) {
+			return "", false
+		}
+
+		return string(rv.Bytes()), true
+	}
+
+	return fmt.Sprint(rv.Interface()), true
+}
+
+func FromValues(vals url.Values, dest interface{}, opts ...Option) error {
+	return TaggedFromValues(vals, dest, DefaultTag, DefaultTag, opts...)
+}
+
+// TaggedFromValues decodes vals into dest. Slice fields receive every value
+// for their key and all other fields receive the first; a slice field with
+// split= receives the values joined by its separator. Values are decoded as
+// strings, so field flags and decode options apply as they do for FromMapE,
+// and whatever is still a string after those is parsed into the field's
+// kind.
+func TaggedFromValues(vals url.Values, dest interface{}, nameTag string, filterTag string, opts ...Option) error {
+	d := newDecoder(nameTag, filterTag, newOptions(opts))
+	d.parseStrings = true
+	info, err := getMappings(dest, nameTag, filterTag, d.o)
+	if err != nil {
+		return err
+	}
+
+	m := make(map[string]interface{}, len(vals))
+	for key, values := range vals {
+		if len(values) < 1 {
+			continue
+		}
+
+		m[key] = values[0]
+		field, ok := info.Fields[key]
+		if !ok {
+			continue
+		}
+
+		if t := fieldType(field); t.Kind() == reflect.Slice && !isBytesType(t) {
+			if sep, ok := info.flags[key].Param("split"); ok {
+				m[key] = strings.Join(values, sep)
+			} else {
+				m[key] = values
+			}
+		}
+	}
+
+	return d.decodeRoot(m, dest)
+}
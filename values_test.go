@@ -0,0 +1,76 @@
+package mapsmith
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+type form struct {
+	Name  string   `map:"name"`
+	Age   int      `map:"age"`
+	IDs   []int    `map:"ids"`
+	Tags  []string `map:"tags,split=,"`
+	On    bool     `map:"on"`
+	Delim rune     `map:"delim,char"`
+	Ptr   *int     `map:"ptr"`
+}
+
+func TestFromValues(t *testing.T) {
+	vals := url.Values{
+		"name":  {"ann", "bob"},
+		"age":   {"30"},
+		"ids":   {"1", "2", "3"},
+		"tags":  {"a,b", "c"},
+		"on":    {"yes"},
+		"delim": {";"},
+		"ptr":   {"7"},
+	}
+
+	var got form
+	if err := FromValues(vals, &got, WithBoolStrings([]string{"yes"}, []string{"no"})); err != nil {
+		t.Fatal(err)
+	}
+
+	seven := 7
+	want := form{Name: "ann", Age: 30, IDs: []int{1, 2, 3}, Tags: []string{"a", "b", "c"}, On: true, Delim: ';', Ptr: &seven}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("FromValues = %+v, want %+v", got, want)
+	}
+}
+
+func TestFromValuesReportsParseErrors(t *testing.T) {
+	var got form
+	err := FromValues(url.Values{"age": {"old"}, "ids": {"1", "x"}, "name": {"n"}}, &got)
+	de, ok := err.(*DecodeError)
+	if !ok || len(de.Errors) != 2 || de.Errors[0].Key != "age" || de.Errors[1].Key != "ids" {
+		t.Fatalf("err = %v, want errors for age and ids", err)
+	}
+
+	if got.Name != "n" {
+		t.Fatalf("valid value not decoded: %+v", got)
+	}
+}
+
+func TestToValues(t *testing.T) {
+	type query struct {
+		Q     string   `map:"q"`
+		Page  int      `map:"page"`
+		Tags  []string `map:"tag"`
+		Empty string   `map:"empty,omitempty"`
+		Zero  int      `map:"zero"`
+		Inner dbConfig `map:"inner"`
+		Ptr   *int     `map:"ptr"`
+	}
+
+	vals := ToValues(query{Q: "go", Page: 2, Tags: []string{"a", "b"}, Inner: dbConfig{"h", 1}})
+	want := url.Values{"q": {"go"}, "page": {"2"}, "tag": {"a", "b"}, "zero": {"0"}}
+	if !reflect.DeepEqual(vals, want) {
+		t.Fatalf("ToValues = %v, want %v", vals, want)
+	}
+
+	flat := ToValues(query{Inner: dbConfig{"h", 1}}, WithFlattenValues())
+	if flat.Get("inner.host") != "h" || flat.Get("inner.port") != "1" {
+		t.Fatalf("flattened = %v", flat)
+	}
+}